@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// contextBoost is how much a word that the model expects after the
+// previous words outweighs its plain frequency when guessing the next
+// letter.
+const contextBoost = 10
+
+// updateLetterOdds recomputes how likely each letter is to come next,
+// which layout turns into wider ring segments. In "word" mode it only
+// changes between words, so targets stay put while a word is typed.
+func (g *Game) updateLetterOdds() {
+	mode := g.config.Prediction.AdaptiveRings
+	if mode == "off" || mode == "" || g.model == nil {
+		g.letterOdds = nil
+		return
+	}
+	var prefix string
+	if n := len(g.sentence.words); n > 0 {
+		prefix = g.sentence.words[n-1]
+	}
+	if mode == "word" && prefix != "" {
+		return
+	}
+	g.letterOdds = g.nextLetterOdds(prefix, g.completeWords())
+}
+
+// nextLetterOdds returns the probability of each letter following
+// prefix, from the total frequency of the words each letter leads to,
+// boosting the most frequent of them when the model expects them after
+// the previous words.
+func (g *Game) nextLetterOdds(prefix string, previous []string) map[rune]float64 {
+	odds := map[rune]float64{}
+	var total float64
+	for _, b := range g.vocabulary.Branches(strings.ToLower(prefix)) {
+		weight := b.Total
+		for _, c := range b.Top {
+			weight += c.Score * contextBoost * g.model.Score(previous, c.Word)
+		}
+		odds[b.Letter] = weight
+		total += weight
+	}
+	for r := range odds {
+		odds[r] /= total
+	}
+	return odds
+}
+
+// letterWeights returns the segment weights of a ring: 1 for every
+// entry, plus a share proportional to the odds of single-letter entries.
+// It returns nil, for even spacing, when no entry is a likely letter.
+func (g *Game) letterWeights(entries []string) []float64 {
+	if g.letterOdds == nil {
+		return nil
+	}
+	strength := g.config.Prediction.AdaptiveStrength * float64(len(entries))
+	weights := make([]float64, len(entries))
+	adapted := false
+	for i, entry := range entries {
+		weights[i] = 1
+		r, ok := letter(entry)
+		if !ok {
+			continue
+		}
+		if p := g.letterOdds[r]; p > 0 {
+			weights[i] += strength * p
+			adapted = true
+		}
+	}
+	if !adapted {
+		return nil
+	}
+	return weights
+}
+
+// letter returns the lowercase letter typed by a ring entry, if it types
+// a single letter.
+func letter(entry string) (rune, bool) {
+	r, size := utf8.DecodeRuneInString(entry)
+	if size == 0 || size != len(entry) || !unicode.IsLetter(r) {
+		return 0, false
+	}
+	return unicode.ToLower(r), true
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kidandcat/control/ngram"
+)
+
+// correctionMaxCost is how many edits autocorrect may make to a word,
+// with edits costed as for fuzzy completion.
+const correctionMaxCost = 1
+
+// correction is an automatic correction that can still be undone.
+type correction struct {
+	original  string // the word as typed
+	corrected string // what it was replaced with
+	boundary  string // the key that ended the word, "space" or "enter"
+}
+
+// autocorrect replaces the word just finished, if it is unknown, with
+// the best scoring known word within correctionMaxCost edits. It runs
+// before boundary is typed and remembers the correction, so that the
+// next button press can undo it.
+func (g *Game) autocorrect(boundary string) {
+	if !g.config.Prediction.Autocorrect || g.model == nil {
+		return
+	}
+	n := len(g.sentence.words)
+	if n == 0 {
+		return
+	}
+	typed := g.sentence.words[n-1]
+	lower := strings.ToLower(typed)
+	if !isWord(lower) || utf8.RuneCountInString(lower) < fuzzyMinLength || g.vocabulary.Count(lower) > 0 {
+		return
+	}
+
+	previous := g.completeWords()
+	var best []ngram.Candidate
+	for _, c := range g.vocabulary.Near(lower, correctionMaxCost, g.substitutionCost) {
+		score := g.model.Score(previous, c.Word) * math.Pow(fuzzyPenalty, c.Score)
+		best = ngram.Rank(best, ngram.Candidate{Word: c.Word, Score: score}, 1)
+	}
+	if len(best) == 0 {
+		return
+	}
+
+	corrected := matchCase(typed, g.surface(best[0].Word, false))
+	g.backspace(utf8.RuneCountInString(typed))
+	g.typeStr(corrected)
+	if err := g.appendToRawText(corrected); err != nil {
+		log.Printf("Error saving correction: %v", err)
+	}
+	g.trackTyped(corrected)
+	g.lastCorrection = &correction{original: typed, corrected: corrected, boundary: boundary}
+	g.logTyped("Corrected '%s' to '%s'", typed, corrected)
+}
+
+// undoCorrection puts back the word as it was typed, followed by the key
+// that ended it, and learns the word so it isn't corrected again.
+func (g *Game) undoCorrection(c *correction) {
+	g.backspace(1 + utf8.RuneCountInString(c.corrected))
+	g.typeStr(c.original)
+	typed := c.original
+	if c.boundary == "space" {
+		g.typeStr(" ")
+		typed += " "
+	} else {
+		g.tapKey(c.boundary)
+		typed += "\n"
+	}
+	if err := g.appendToRawText(typed); err != nil {
+		log.Printf("Error saving undone correction: %v", err)
+	}
+	// After Enter the backspaces reopened the sentence, unlearning it,
+	// and it is learned again as typed
+	g.trackTyped(typed)
+	if g.learning() {
+		g.learnWord(c.original)
+	}
+	g.logTyped("Undid correction of '%s' to '%s'", c.original, c.corrected)
+	g.updatePrediction()
+}
+
+// learnWord teaches the model a word on its own, and saves it to the
+// corpus.
+func (g *Game) learnWord(word string) {
+	word = normalizeWord(word)
+	g.model.AddWord(fold(word), 1)
+	g.forms.addWord(word, 1)
+	g.vocabulary.Add(fold(word), 1)
+	if g.corpus != nil {
+		if err := g.corpus.learnWord(word, 1); err != nil {
+			log.Printf("Error saving corpus: %v", err)
+		}
+	}
+}
+
+// isWord reports whether s is made of letters and apostrophes only, so
+// numbers and symbols are never corrected.
+func isWord(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) && r != '\'' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// matchCase returns word in the case of typed: all capitals, a leading
+// capital, or as it is.
+func matchCase(typed, word string) string {
+	first, _ := utf8.DecodeRuneInString(typed)
+	switch {
+	case utf8.RuneCountInString(typed) > 1 && typed == strings.ToUpper(typed):
+		return strings.ToUpper(word)
+	case unicode.IsUpper(first):
+		r, size := utf8.DecodeRuneInString(word)
+		return string(unicode.ToUpper(r)) + word[size:]
+	}
+	return word
+}
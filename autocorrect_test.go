@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// keyFrames returns the frames that type text on the default layout:
+// lowercase letters from the outer ring, space with X, a newline with Y
+// and "\b" with B, spaced out past the debounce.
+func keyFrames(text string) []InputFrame {
+	var frames []InputFrame
+	for _, r := range text {
+		var f InputFrame
+		switch {
+		case r >= 'a' && r <= 'z':
+			f = Stick(float64(r-'a')*360/26, 1).Press(ButtonA)
+		case r == ' ':
+			f = f.Press(ButtonX)
+		case r == '\n':
+			f = f.Press(ButtonY)
+		case r == '\b':
+			f = f.Press(ButtonB)
+		}
+		f.Time = scriptStart.Add(time.Duration(len(frames)) * time.Second)
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+func TestUndoCorrectionAtEnter(t *testing.T) {
+	config := defaultConfig()
+	config.Prediction.Autocorrect = true
+	g := &Game{output: &recordingOutput{}, dataDir: t.TempDir(), config: config}
+	for _, f := range keyFrames("is thid\n") {
+		g.step(f)
+	}
+	if got := g.corpus.model.Following("is")["this"]; got != 1 {
+		t.Fatalf("learned \"is this\" %g times after the correction, want 1", got)
+	}
+	for _, f := range keyFrames("\b") {
+		g.step(f)
+	}
+
+	following := g.corpus.model.Following("is")
+	if following["this"] != 0 || following["thid"] != 1 {
+		t.Errorf("after undoing, learned \"is this\" %g and \"is thid\" %g times, want 0 and 1", following["this"], following["thid"])
+	}
+	if got := g.output.(*recordingOutput).Text(); got != "Is thid\n" {
+		t.Errorf("typed %q, want %q", got, "Is thid\n")
+	}
+	data, err := os.ReadFile(filepath.Join(g.dataDir, rawTextFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rawTextString(parseRawTextChunks(data)); got != "Is thid\n" {
+		t.Errorf("typed text %q, want %q", got, "Is thid\n")
+	}
+	if !strings.Contains(string(data), "this\n"+strings.Repeat(rawTextBackspace, 5)) {
+		t.Errorf("typed text %q doesn't record the correction and its undoing", data)
+	}
+}
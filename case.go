@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The model and vocabulary only know lowercase words, so that "Hello" at
+// the start of a sentence and "hello" after a comma count as the same
+// word. How each word is written is remembered apart from them, to offer
+// predictions the way the user writes them: "I", "NASA", "iPhone".
+
+// fold returns word as the model knows it.
+func fold(word string) string {
+	return strings.ToLower(word)
+}
+
+// foldSentence returns the words of sentence as the model knows them.
+func foldSentence(sentence []string) []string {
+	folded := make([]string, len(sentence))
+	for i, word := range sentence {
+		folded[i] = fold(word)
+	}
+	return folded
+}
+
+// capitalize returns word with its first letter in uppercase.
+func capitalize(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
+
+// wordForms counts, for each lowercase word, how often it was written
+// some other way. How often it was written in lowercase is the rest of
+// its count in the model.
+type wordForms map[string]map[string]float64
+
+// add counts how the words of sentence are written. A first word that is
+// only capitalized because it starts the sentence counts as lowercase.
+func (f wordForms) add(sentence []string, weight float64) {
+	for i, word := range sentence {
+		if i == 0 && word == capitalize(fold(word)) {
+			continue
+		}
+		f.addWord(word, weight)
+	}
+}
+
+// addWord counts how word is written.
+func (f wordForms) addWord(word string, weight float64) {
+	lower := fold(word)
+	if word == lower {
+		return
+	}
+	if f[lower] == nil {
+		f[lower] = map[string]float64{}
+	}
+	f[lower][word] += weight
+}
+
+// merge adds the counts of other to f.
+func (f wordForms) merge(other wordForms) {
+	for _, forms := range other {
+		for form, c := range forms {
+			f.addWord(form, c)
+		}
+	}
+}
+
+// scale multiplies every count by factor.
+func (f wordForms) scale(factor float64) {
+	for _, forms := range f {
+		for form := range forms {
+			forms[form] *= factor
+		}
+	}
+}
+
+// prune drops the forms of words the model no longer knows and forms
+// not written any more.
+func (f wordForms) prune(unigrams map[string]float64) {
+	for lower, forms := range f {
+		for form, c := range forms {
+			if c <= 0 || unigrams[lower] <= 0 {
+				delete(forms, form)
+			}
+		}
+		if len(forms) == 0 {
+			delete(f, lower)
+		}
+	}
+}
+
+// best returns how lowercase word is most often written, given its total
+// count, preferring lowercase on a tie.
+func (f wordForms) best(word string, total float64) string {
+	best := word
+	count := total
+	for _, c := range f[word] {
+		count -= c
+	}
+	for form, c := range f[word] {
+		if c > count || c == count && best != word && form < best {
+			best, count = form, c
+		}
+	}
+	return best
+}
+
+// surface returns a lowercase word the way the user writes it, capitalized
+// if it starts a sentence.
+func (g *Game) surface(word string, first bool) string {
+	if g.model != nil {
+		word = g.forms.best(word, g.model.Unigrams()[word])
+	}
+	if first {
+		word = capitalize(word)
+	}
+	return word
+}
+
+// sentenceStart reports whether nothing of the current sentence has been
+// typed yet: at the start, or after ↵ or a sentence-ending punctuation
+// mark.
+func (g *Game) sentenceStart() bool {
+	for _, word := range g.sentence.words {
+		if word != "" {
+			return false
+		}
+	}
+	return true
+}
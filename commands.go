@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// command is a subcommand run instead of the keyboard, as in
+// "control replay session.rec".
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"replay":  {"replay [-text] FILE: print the keystrokes a recording produces", runReplay},
+	"stats":   {"stats: show the size of the learned corpus", runStats},
+	"purge":   {"purge [-from TIME] [-to TIME]: delete text typed between two times, and forget it", runPurge},
+	"encrypt": {"encrypt: encrypt saved data once storage.encrypt is on", runEncrypt},
+	"inspect": {"inspect COMMAND [args]: show what has been learned, or what would be predicted", runInspect},
+	"import":  {"import [-format FORMAT] [-weight W] [-dry-run] FILE...: learn from text, Markdown, shell history or git logs", runImport},
+}
+
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return cmd.run(args)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags]\n       %s COMMAND [args]\n\nFlags:\n", os.Args[0], os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s\n", commands[name].usage)
+	}
+}
+
+// runReplay feeds a recording through the keyboard and prints what it
+// would type. It uses the config the recording was made with and only
+// the built-in training phrases, never touching saved data, so the
+// output depends on nothing but the recording. A recording cut short,
+// as when the program was killed, replays up to where it ends.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	text := fs.Bool("text", false, "print the resulting text instead of each keystroke")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: replay [-text] FILE")
+	}
+
+	input, err := openReplayInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	out, err := replay(input, input.config)
+	cut := errors.Is(err, io.ErrUnexpectedEOF)
+	if err != nil && !cut {
+		return err
+	}
+	if *text {
+		fmt.Print(out.Text())
+	} else {
+		for _, e := range out.Events {
+			fmt.Println(e)
+		}
+	}
+	if cut {
+		log.Printf("Warning: %s ends with a frame cut short, replayed the frames before it", fs.Arg(0))
+	}
+	return nil
+}
+
+// replay runs every frame of input through a fresh in-memory game with
+// config and returns the keystrokes it produced. A recording's frames
+// are handled with learning paused wherever it was when they were
+// recorded.
+func replay(input InputSource, config Config) (*recordingOutput, error) {
+	out := &recordingOutput{}
+	g := &Game{
+		input:  input,
+		output: out,
+		config: config,
+	}
+	p, _ := input.(*replayInput)
+	if p != nil {
+		g.window = p.window
+	}
+	for {
+		f, err := input.Poll()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err == errNoGamepad {
+			continue
+		}
+		if err != nil {
+			return out, err
+		}
+		if p != nil && p.gap {
+			g.pauseLearning()
+		}
+		g.step(f)
+	}
+}
+
+// loadGame returns a game with the user's data directory and config, for
+// commands that work on saved data. With readOnly, nothing saved is
+// changed, not even to migrate or compact it.
+func loadGame(readOnly bool) (*Game, error) {
+	dataDir, err := defaultDataDir()
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadConfig(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openStorage(dataDir, config.Storage, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &Game{dataDir: dataDir, store: store, config: config}, nil
+}
+
+// runStats prints how big the learned corpus is, to help tune its limits.
+func runStats(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: stats")
+	}
+	g, err := loadGame(true)
+	if err != nil {
+		return err
+	}
+	corpus, err := g.openCorpus()
+	if err != nil {
+		return err
+	}
+
+	st := corpus.model.Stats()
+	fmt.Printf("Vocabulary:  %d words\n", st.NGrams[0])
+	for n, count := range st.NGrams[1:] {
+		fmt.Printf("%d-grams:     %d\n", n+2, count)
+	}
+	fmt.Printf("Words typed: %.0f\n", st.Total)
+	fmt.Printf("Memory:      about %s\n", formatBytes(int64(st.Bytes)))
+	for _, name := range []string{corpusFile, corpusLogFile, corpusHistoryFile} {
+		if info, err := os.Stat(filepath.Join(g.dataDir, name)); err == nil {
+			fmt.Printf("%-19s %s\n", name+":", formatBytes(info.Size()))
+		}
+	}
+	fmt.Printf("Log entries: %d of %d before compaction\n", corpus.logged, compactEvery)
+	return nil
+}
+
+// formatBytes returns n in bytes, KB or MB.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// timeLayouts are the formats purge accepts times in, in local time
+// unless they say otherwise.
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad time %q, want e.g. \"2006-01-02 15:04\"", s)
+}
+
+// runPurge deletes the text typed from -from up to -to from the typed
+// text file and forgets what was learned from it in that time. Text typed
+// before times were recorded counts as typed before any -from. What was
+// learned before the corpus history was started is forgotten by the
+// sentences of the deleted text instead.
+func runPurge(args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	fromFlag := fs.String("from", "", "start of the time range, e.g. \"2006-01-02 15:04\" (default: the beginning)")
+	toFlag := fs.String("to", "", "end of the time range, not included (default: now)")
+	fs.Parse(args)
+	if fs.NArg() != 0 || *fromFlag == "" && *toFlag == "" {
+		return fmt.Errorf("usage: purge [-from TIME] [-to TIME], with at least one of them")
+	}
+	var from, to time.Time
+	var err error
+	if *fromFlag != "" {
+		if from, err = parseTime(*fromFlag); err != nil {
+			return err
+		}
+	}
+	to = time.Now().Add(time.Minute)
+	if *toFlag != "" {
+		if to, err = parseTime(*toFlag); err != nil {
+			return err
+		}
+	}
+
+	g, err := loadGame(false)
+	if err != nil {
+		return err
+	}
+	data, err := g.files().readFile(rawTextFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var kept, purged []rawTextChunk
+	afterPurged := false
+	for _, c := range parseRawTextChunks(data) {
+		// A chunk can hold text typed up to rawTextStampInterval after its mark
+		if (*fromFlag == "" || !c.Time.Add(rawTextStampInterval).Before(from)) && c.Time.Before(to) {
+			purged = append(purged, c)
+			afterPurged = true
+			continue
+		}
+		if afterPurged {
+			// Its first backspaces deleted purged text
+			c.Text = strings.TrimLeft(c.Text, rawTextBackspace)
+		}
+		kept = append(kept, c)
+		afterPurged = false
+	}
+	if len(purged) > 0 {
+		if err := g.files().writeFile(rawTextFile, formatRawTextChunks(kept)); err != nil {
+			return err
+		}
+	}
+
+	corpus, err := g.openCorpus()
+	if err != nil {
+		return fmt.Errorf("couldn't forget what was typed: %w", err)
+	}
+	started, _, err := corpus.readHistory()
+	if err != nil {
+		return fmt.Errorf("couldn't forget what was typed: %w", err)
+	}
+	var older []rawTextChunk
+	for _, c := range purged {
+		if c.Time.Before(started) {
+			older = append(older, c)
+		}
+	}
+	forgotten, err := corpus.forget(from, to, parseRawText(rawTextKeys(older)))
+	if err != nil {
+		return fmt.Errorf("couldn't forget what was typed: %w", err)
+	}
+	if len(purged) == 0 && forgotten == 0 {
+		fmt.Println("Nothing was typed in that time.")
+		return nil
+	}
+	fmt.Printf("Deleted %d characters typed in %d stretches and forgot %d sentences and words learned then.\n",
+		len([]rune(rawTextString(purged))), len(purged), forgotten)
+	return nil
+}
+
+// runEncrypt encrypts the saved data that isn't yet, so that
+// storage.encrypt can be turned on when there already is some. Each file
+// is replaced whole, never left half encrypted.
+func runEncrypt(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: encrypt")
+	}
+	dataDir, err := defaultDataDir()
+	if err != nil {
+		return err
+	}
+	config, err := loadConfig(dataDir)
+	if err != nil {
+		return err
+	}
+	if !config.Storage.Encrypt {
+		return fmt.Errorf("turn on storage.encrypt in %s first", filepath.Join(dataDir, configFile))
+	}
+	sealed, err := newStorage(dataDir, config.Storage, false)
+	if err != nil {
+		return err
+	}
+
+	plain := &storage{dir: dataDir}
+	encrypted := 0
+	for _, name := range storedFiles {
+		isSealed, err := plain.isSealed(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if isSealed {
+			continue
+		}
+		data, err := plain.readFile(name)
+		if err != nil {
+			return err
+		}
+		if name == corpusLogFile || name == corpusHistoryFile {
+			// Drop an entry cut short, which would otherwise run into
+			// the next one appended
+			data = data[:bytes.LastIndexByte(data, '\n')+1]
+		}
+		if err := sealed.writeFile(name, data); err != nil {
+			return err
+		}
+		fmt.Printf("Encrypted %s\n", name)
+		encrypted++
+	}
+	if encrypted == 0 {
+		fmt.Println("Nothing to encrypt.")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kidandcat/control/ngram"
+)
+
+// completionPool is how many completions of a partial word are taken
+// from the model and from the vocabulary before ranking them together.
+const completionPool = 10
+
+// contextWeight is how much the words before a partial word count,
+// against how common each completion is on its own, when ranking
+// completions.
+const contextWeight = 0.7
+
+// Fuzzy completion offers words whose start is within fuzzyMaxCost edits
+// of a partial word of at least fuzzyMinLength letters. Picking the
+// entry next to the intended one on a ring costs neighbourCost, any
+// other mistake 1, and each unit of cost scales a candidate's score by
+// fuzzyPenalty.
+const (
+	fuzzyMaxCost   = 1
+	fuzzyMinLength = 2
+	neighbourCost  = 0.5
+	fuzzyPenalty   = 0.2
+)
+
+// complete returns the best completions of the partial word prefix after
+// the words in previous. Each candidate scores its share of the n-gram
+// scores of all candidates, blended by contextWeight with its share of
+// their frequency, so "good mo" completes to "morning" when "good
+// morning" has been typed before, even if "more" is more common. With
+// fuzzy completion on, words that start with a likely typo of prefix are
+// offered too, but never ahead of a word that starts with prefix itself.
+func (g *Game) complete(previous []string, prefix string) []ngram.Candidate {
+	prefix = strings.ToLower(prefix)
+
+	// Gather candidates, keeping the model's spelling of each word
+	words := map[string]string{}
+	for _, c := range g.model.TopPrefix(previous, prefix, completionPool) {
+		words[strings.ToLower(c.Word)] = c.Word
+	}
+	for _, c := range g.vocabulary.Complete(prefix) {
+		if _, ok := words[c.Word]; !ok {
+			words[c.Word] = c.Word
+		}
+	}
+	typos := map[string]float64{} // edit cost of each fuzzy candidate
+	if g.config.Prediction.Fuzzy && utf8.RuneCountInString(prefix) >= fuzzyMinLength {
+		for _, c := range g.vocabulary.Fuzzy(prefix, fuzzyMaxCost, g.substitutionCost) {
+			if _, ok := words[c.Word]; !ok && !strings.HasPrefix(c.Word, prefix) {
+				words[c.Word] = c.Word
+				typos[c.Word] = c.Score
+			}
+		}
+	}
+
+	contextScores := map[string]float64{}
+	var contextTotal, countTotal float64
+	for lower, word := range words {
+		contextScores[lower] = g.model.Score(previous, word)
+		contextTotal += contextScores[lower]
+		countTotal += g.vocabulary.Count(lower)
+	}
+
+	var top []ngram.Candidate
+	var bestExact ngram.Candidate
+	for lower, word := range words {
+		var score float64
+		if contextTotal > 0 {
+			score += contextWeight * contextScores[lower] / contextTotal
+		}
+		if countTotal > 0 {
+			score += (1 - contextWeight) * g.vocabulary.Count(lower) / countTotal
+		}
+		c := ngram.Candidate{Word: word, Score: score}
+		if cost, ok := typos[lower]; ok {
+			c.Score *= math.Pow(fuzzyPenalty, cost)
+		} else if best := ngram.Rank([]ngram.Candidate{bestExact}, c, 1); best[0] == c {
+			bestExact = c
+		}
+		top = ngram.Rank(top, c, predictionSlots)
+	}
+
+	// Keep an exact completion first, so a correction is only ever
+	// offered to the side
+	if bestExact.Word != "" && top[0] != bestExact {
+		rest := []ngram.Candidate{bestExact}
+		for _, c := range top {
+			if c != bestExact && len(rest) < predictionSlots {
+				rest = append(rest, c)
+			}
+		}
+		top = rest
+	}
+	return top
+}
+
+// substitutionCost is the cost of typing b instead of a: neighbourCost
+// if they sit next to each other on a ring, else 1.
+func (g *Game) substitutionCost(a, b rune) float64 {
+	if g.neighbours[[2]rune{a, b}] {
+		return neighbourCost
+	}
+	return 1
+}
+
+// findNeighbours records which letters sit next to each other on the
+// rings of every character set, ignoring case.
+func (g *Game) findNeighbours() {
+	g.neighbours = map[[2]rune]bool{}
+	for _, set := range g.rings {
+		for _, entries := range set {
+			for i := range entries {
+				a, okA := letter(entries[i])
+				b, okB := letter(entries[(i+1)%len(entries)])
+				if okA && okB && a != b {
+					g.neighbours[[2]rune{a, b}] = true
+					g.neighbours[[2]rune{b, a}] = true
+				}
+			}
+		}
+	}
+}
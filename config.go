@@ -0,0 +1,483 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kidandcat/control/ngram"
+	"github.com/kidandcat/control/ring"
+)
+
+const configFile = "config.json"
+
+// ringPadding is the room left around the outer ring for its characters.
+const ringPadding = 30
+
+// Config is the user configuration, read from config.json in the data
+// directory. Anything left out keeps its built-in default.
+type Config struct {
+	Layout     LayoutConfig     `json:"layout"`
+	Prediction PredictionConfig `json:"prediction"`
+	Corpus     CorpusConfig     `json:"corpus"`
+	Privacy    PrivacyConfig    `json:"privacy"`
+	Storage    StorageConfig    `json:"storage"`
+	Typing     TypingConfig     `json:"typing"`
+}
+
+// TypingConfig saves keystrokes around sentences and punctuation. Both
+// are on unless set to false.
+type TypingConfig struct {
+	// AutoShift capitalizes the first letter of each sentence, and
+	// predictions offered for it, after ↵ or a sentence-ending mark.
+	AutoShift *bool `json:"auto_shift"`
+	// SmartPunctuation removes the space typed after an accepted
+	// prediction when the next thing typed is punctuation that goes
+	// right after a word, such as "." or ",".
+	SmartPunctuation *bool `json:"smart_punctuation"`
+}
+
+func (t TypingConfig) autoShift() bool {
+	return t.AutoShift == nil || *t.AutoShift
+}
+
+func (t TypingConfig) smartPunctuation() bool {
+	return t.SmartPunctuation == nil || *t.SmartPunctuation
+}
+
+// StorageConfig controls how the typed text and corpus are saved.
+type StorageConfig struct {
+	// Encrypt seals saved files with a key from the system keyring, or
+	// from PassphraseFile if set. Turning it on for existing data needs
+	// "control encrypt".
+	Encrypt bool `json:"encrypt"`
+	// PassphraseFile is a file holding a passphrase to derive the key
+	// from, for systems without a keyring.
+	PassphraseFile string `json:"passphrase_file"`
+}
+
+// PrivacyConfig controls when typing is neither recorded nor learned.
+type PrivacyConfig struct {
+	// DenyWindows pauses recording while the focused window's title or
+	// class contains any of these, ignoring case. Unset, it covers
+	// password managers and prompts; set it to [] to turn this off. On
+	// Linux it only sees X11 windows, so it does nothing on Wayland or
+	// without a display.
+	DenyWindows []string `json:"deny_windows"`
+}
+
+// defaultDenyWindows are the windows never recorded unless configured
+// otherwise.
+var defaultDenyWindows = []string{
+	"password", "passphrase", "pinentry", "keepass", "1password", "bitwarden", "sudo",
+}
+
+// CorpusConfig limits how much of what the user typed is remembered.
+// Limits are applied whenever the corpus is compacted; zero turns each
+// one off.
+type CorpusConfig struct {
+	// HalfLifeDays halves every count after this many days, so a burst
+	// of typing fades instead of skewing predictions forever.
+	HalfLifeDays float64 `json:"half_life_days"`
+	// PruneAbove drops n-grams seen about once whenever the corpus holds
+	// more than this many n-grams.
+	PruneAbove int `json:"prune_above"`
+	// MaxNGrams drops the rarest n-grams beyond this many.
+	MaxNGrams int `json:"max_ngrams"`
+}
+
+// PredictionConfig tunes word prediction and how it shapes the rings.
+type PredictionConfig struct {
+	// AdaptiveRings widens the segments of likely next letters: "off",
+	// "live" to follow every keystroke, or "word" to change only between
+	// words so targets don't move while a word is being typed.
+	AdaptiveRings string `json:"adaptive_rings"`
+	// AdaptiveStrength is how much wider likely letters get. At 1, a
+	// letter that is certain to come next is as wide as the rest of its
+	// ring together.
+	AdaptiveStrength float64 `json:"adaptive_strength"`
+	// Order is the length of the word n-grams predictions are based on,
+	// from 2 (the previous word) to 4 (the previous three).
+	Order int `json:"order"`
+	// Fuzzy also offers completions of likely typos of a partial word,
+	// such as picking a ring entry's neighbour by mistake.
+	Fuzzy bool `json:"fuzzy"`
+	// Autocorrect replaces an unknown word with the best close match
+	// when space or enter ends it. Pressing B right after undoes that.
+	Autocorrect bool `json:"autocorrect"`
+}
+
+// LayoutConfig describes the character sets of the ring keyboard.
+type LayoutConfig struct {
+	Sets []SetConfig `json:"sets"`
+	// SetSwitch is how sets are chosen: "hold" shows a set while its
+	// Hold button is down, "cycle" moves to the next set each time
+	// CycleButton is pressed.
+	SetSwitch   string `json:"set_switch"`
+	CycleButton string `json:"cycle_button"`
+
+	holdButtons []Button // parsed Hold of each set, -1 for none
+	cycleButton Button
+}
+
+// SetConfig is one character set: the rings shown together.
+type SetConfig struct {
+	Name  string       `json:"name"`
+	Hold  string       `json:"hold"`  // button that shows this set in "hold" mode
+	Rings []RingConfig `json:"rings"` // innermost first
+}
+
+// RingConfig is one ring of a character set.
+type RingConfig struct {
+	Entries []string `json:"entries"` // clockwise from 12 o'clock
+	Radius  float64  `json:"radius"`  // in pixels
+	Color   string   `json:"color"`   // background as "#rrggbb"
+	// Band is the stick magnitude at which this ring starts. By default
+	// the outermost ring takes the last 10% of the stick's travel and
+	// the others share the rest equally. Ignored for the first ring.
+	Band float64 `json:"band"`
+
+	rgba color.RGBA // parsed Color
+}
+
+// Defaults for each ring position, innermost first. Rings past the end
+// of these lists keep growing by the last radius step and reuse colors.
+var (
+	defaultRadii  = []float64{120, 200}
+	defaultColors = []string{"#502828", "#282850", "#285028", "#505028"} // dark red, blue, green, yellow
+)
+
+// outerBand is where the outermost ring starts by default: the rim of
+// the stick's travel.
+const outerBand = 0.9
+
+// reservedButtons already have a fixed job and can't switch sets.
+var reservedButtons = map[Button]string{
+	ButtonA: "select", ButtonB: "backspace", ButtonX: "space", ButtonY: "enter",
+	ButtonR1: "uppercase", ButtonR2: "prediction", ButtonStart: "visibility",
+	ButtonUp: "arrows", ButtonDown: "arrows", ButtonLeft: "arrows", ButtonRight: "arrows",
+}
+
+// namedKeys are ring entries that tap a key instead of typing text. The
+// ring shows keyLabels in place of symbols the font may not have.
+var (
+	namedKeys = map[string]string{
+		"⌫": "backspace", "↵": "enter", "⇥": "tab", "⎋": "esc", "⌦": "delete",
+		"⇱": "home", "⇲": "end", "⇞": "pageup", "⇟": "pagedown",
+		"↑": "up", "↓": "down", "←": "left", "→": "right",
+	}
+	keyLabels = map[string]string{
+		"⇥": "Tab", "⎋": "Esc", "⌦": "Del",
+		"⇱": "Home", "⇲": "End", "⇞": "PgUp", "⇟": "PgDn",
+	}
+)
+
+// defaultConfig returns the built-in layout: letters and numbers in the
+// main set, coding symbols while L1 is held and navigation keys while L2
+// is held.
+func defaultConfig() Config {
+	cfg := Config{Layout: LayoutConfig{Sets: []SetConfig{
+		{
+			Name: "main",
+			Rings: []RingConfig{
+				// Numbers + common symbols
+				{Entries: []string{
+					"0", "1", "2", "3", "4", "5", "6", "7", "8", "9",
+					".", ",", "-", "_", "⌫", "↵",
+				}},
+				// All letters
+				{Entries: []string{
+					"A", "B", "C", "D", "E", "F", "G", "H", "I", "J",
+					"K", "L", "M", "N", "O", "P", "Q", "R", "S", "T",
+					"U", "V", "W", "X", "Y", "Z",
+				}},
+			},
+		},
+		{
+			Name: "symbols",
+			Hold: "L1",
+			Rings: []RingConfig{
+				// Brackets and special chars
+				{Entries: []string{
+					"(", ")", "[", "]", "{", "}", "<", ">", "'", "\"",
+					"`", "~", "!", "?", "⌫", "↵",
+				}},
+				// Operators and symbols
+				{Entries: []string{
+					"+", "-", "*", "/", "=", "!=", "==", "&&", "||", "%",
+					"&", "|", "^", "<<", ">>", "@", "#", "$", ":", ";",
+					"\\", ".", ",", "_", "->", "=>",
+				}},
+			},
+		},
+		{
+			Name: "navigation",
+			Hold: "L2",
+			Rings: []RingConfig{
+				// Page keys up and down, line ends left and right
+				{Entries: []string{"⇞", "⇥", "⇲", "↵", "⇟", "⌫", "⇱", "⎋"}},
+				// Arrows where they point
+				{Entries: []string{"↑", "→", "↓", "←"}},
+			},
+		},
+	}}}
+	if err := cfg.validate(); err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// loadConfig reads config.json from dir. A missing file gives the
+// defaults. An invalid file gives the defaults along with an error
+// explaining what is wrong.
+func loadConfig(dir string) (Config, error) {
+	path := filepath.Join(dir, configFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaultConfig(), nil
+	}
+	if err != nil {
+		return defaultConfig(), err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return defaultConfig(), fmt.Errorf("%s: %w", path, err)
+	}
+	if len(cfg.Layout.Sets) == 0 {
+		cfg.Layout = defaultConfig().Layout
+	}
+	if err := cfg.validate(); err != nil {
+		return defaultConfig(), fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// validate checks the whole config and fills in defaults.
+func (c *Config) validate() error {
+	if err := c.Layout.validate(); err != nil {
+		return err
+	}
+	if err := c.Prediction.validate(); err != nil {
+		return err
+	}
+	if err := c.Corpus.validate(); err != nil {
+		return err
+	}
+	if err := c.Privacy.validate(); err != nil {
+		return err
+	}
+	return c.Storage.validate()
+}
+
+// validate checks the storage settings.
+func (s *StorageConfig) validate() error {
+	if s.PassphraseFile != "" && !s.Encrypt {
+		return errors.New("storage.passphrase_file: set, but storage.encrypt is off")
+	}
+	return nil
+}
+
+// validate fills in the default deny list.
+func (p *PrivacyConfig) validate() error {
+	if p.DenyWindows == nil {
+		p.DenyWindows = defaultDenyWindows
+	}
+	for i, pattern := range p.DenyWindows {
+		if pattern == "" {
+			return fmt.Errorf("privacy.deny_windows[%d]: empty pattern would match every window", i)
+		}
+	}
+	return nil
+}
+
+// validate checks the corpus limits.
+func (c *CorpusConfig) validate() error {
+	switch {
+	case c.HalfLifeDays < 0:
+		return fmt.Errorf("corpus.half_life_days: must not be negative, got %g", c.HalfLifeDays)
+	case c.PruneAbove < 0:
+		return fmt.Errorf("corpus.prune_above: must not be negative, got %d", c.PruneAbove)
+	case c.MaxNGrams < 0:
+		return fmt.Errorf("corpus.max_ngrams: must not be negative, got %d", c.MaxNGrams)
+	}
+	return nil
+}
+
+// validate checks the prediction settings and fills in defaults.
+func (p *PredictionConfig) validate() error {
+	switch p.AdaptiveRings {
+	case "":
+		p.AdaptiveRings = "off"
+	case "off", "live", "word":
+	default:
+		return fmt.Errorf("prediction.adaptive_rings: want \"off\", \"live\" or \"word\", got %q", p.AdaptiveRings)
+	}
+	if p.AdaptiveStrength == 0 {
+		p.AdaptiveStrength = 1
+	}
+	if p.AdaptiveStrength < 0 {
+		return fmt.Errorf("prediction.adaptive_strength: must be positive, got %g", p.AdaptiveStrength)
+	}
+	if p.Order == 0 {
+		p.Order = ngram.DefaultOrder
+	}
+	if p.Order < 2 || p.Order > 4 {
+		return fmt.Errorf("prediction.order: want 2 to 4, got %d", p.Order)
+	}
+	return nil
+}
+
+// validate checks the layout and fills in default radii, bands, colors
+// and buttons.
+func (l *LayoutConfig) validate() error {
+	if len(l.Sets) == 0 {
+		return errors.New("layout.sets: need at least one set")
+	}
+	if err := l.validateSetSwitch(); err != nil {
+		return err
+	}
+	for s := range l.Sets {
+		set := &l.Sets[s]
+		if len(set.Rings) == 0 {
+			return fmt.Errorf("layout.sets[%d].rings: need at least one ring", s)
+		}
+		for r := range set.Rings {
+			rc := &set.Rings[r]
+			where := fmt.Sprintf("layout.sets[%d].rings[%d]", s, r)
+			if len(rc.Entries) == 0 {
+				return fmt.Errorf("%s.entries: ring is empty", where)
+			}
+			for i, entry := range rc.Entries {
+				if strings.TrimSpace(entry) == "" {
+					return fmt.Errorf("%s.entries[%d]: entry is blank", where, i)
+				}
+			}
+			if rc.Radius == 0 {
+				rc.Radius = defaultRadius(r)
+			}
+			if rc.Radius < 0 {
+				return fmt.Errorf("%s.radius: must be positive, got %g", where, rc.Radius)
+			}
+			if r > 0 && rc.Radius <= set.Rings[r-1].Radius {
+				return fmt.Errorf("%s.radius: must be larger than the ring inside it (%g)", where, set.Rings[r-1].Radius)
+			}
+			if rc.Color == "" {
+				rc.Color = defaultColors[r%len(defaultColors)]
+			}
+			if r == 0 {
+				rc.Band = 0
+			} else if rc.Band == 0 {
+				rc.Band = defaultBand(r, len(set.Rings))
+			}
+			if r > 0 && (rc.Band <= set.Rings[r-1].Band || rc.Band <= ring.Deadzone || rc.Band > 1) {
+				return fmt.Errorf("%s.band: must be above the ring inside it and the deadzone, and at most 1, got %g", where, rc.Band)
+			}
+			rgba, err := parseColor(rc.Color)
+			if err != nil {
+				return fmt.Errorf("%s.color: %w", where, err)
+			}
+			rc.rgba = rgba
+		}
+	}
+	return nil
+}
+
+// validateSetSwitch checks how sets are switched and parses the buttons
+// involved.
+func (l *LayoutConfig) validateSetSwitch() error {
+	parse := func(where, name string) (Button, error) {
+		b, ok := parseButton(name)
+		if !ok {
+			return 0, fmt.Errorf("%s: unknown button %q", where, name)
+		}
+		if job, ok := reservedButtons[b]; ok {
+			return 0, fmt.Errorf("%s: %s is already used for %s", where, b, job)
+		}
+		return b, nil
+	}
+
+	l.holdButtons = make([]Button, len(l.Sets))
+	switch l.SetSwitch {
+	case "", "hold":
+		l.SetSwitch = "hold"
+		used := map[Button]int{}
+		for s, set := range l.Sets {
+			l.holdButtons[s] = -1
+			if set.Hold == "" {
+				continue
+			}
+			where := fmt.Sprintf("layout.sets[%d].hold", s)
+			b, err := parse(where, set.Hold)
+			if err != nil {
+				return err
+			}
+			if other, ok := used[b]; ok {
+				return fmt.Errorf("%s: %s already holds set %d", where, b, other)
+			}
+			used[b] = s
+			l.holdButtons[s] = b
+		}
+	case "cycle":
+		if l.CycleButton == "" {
+			l.CycleButton = "L1"
+		}
+		b, err := parse("layout.cycle_button", l.CycleButton)
+		if err != nil {
+			return err
+		}
+		l.cycleButton = b
+	default:
+		return fmt.Errorf("layout.set_switch: want \"hold\" or \"cycle\", got %q", l.SetSwitch)
+	}
+	return nil
+}
+
+// defaultRadius returns the radius of ring r when none is configured.
+func defaultRadius(r int) float64 {
+	if r < len(defaultRadii) {
+		return defaultRadii[r]
+	}
+	last := len(defaultRadii) - 1
+	step := defaultRadii[last] - defaultRadii[last-1]
+	return defaultRadii[last] + float64(r-last)*step
+}
+
+// defaultBand returns where ring r of n starts when no band is
+// configured: the outermost ring gets the rim, and the rings inside it
+// split the travel between the deadzone and the rim equally.
+func defaultBand(r, n int) float64 {
+	if r == n-1 {
+		return outerBand
+	}
+	return ring.Deadzone + float64(r)*(outerBand-ring.Deadzone)/float64(n-1)
+}
+
+// screenSize returns the window width and height that fit the largest
+// ring of any set.
+func (l LayoutConfig) screenSize() int {
+	var radius float64
+	for _, set := range l.Sets {
+		for _, rc := range set.Rings {
+			radius = max(radius, rc.Radius)
+		}
+	}
+	return int(2 * (radius + ringPadding))
+}
+
+// parseColor parses an opaque "#rrggbb" color.
+func parseColor(s string) (color.RGBA, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("want #rrggbb, got %q", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("want #rrggbb, got %q", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/kidandcat/control/ngram"
+)
+
+// corpusVersion is the version of the corpus file format written.
+// Version 1 kept words in the case they were typed live.
+const corpusVersion = 2
+
+// seedSentences give predictions something to start with. They are
+// trained into the model on every start but never saved, so they don't
+// pile up in the user's corpus.
+var seedSentences = [][]string{
+	{"hello", "world"},
+	{"how", "are", "you"},
+	{"the", "quick", "brown", "fox"},
+	{"I", "am", "fine"},
+	{"thank", "you", "very", "much"},
+	{"what", "is", "your", "name"},
+	{"nice", "to", "meet", "you"},
+	{"have", "a", "good", "day"},
+	{"see", "you", "later"},
+	{"good", "morning"},
+	{"good", "afternoon"},
+	{"good", "evening"},
+	{"ok", "thanks"},
+	{"ok", "I", "will"},
+	{"ok", "let", "me", "check"},
+	{"ok", "sounds", "good"},
+	{"yes", "I", "agree"},
+	{"no", "thank", "you"},
+	{"please", "help", "me"},
+	{"can", "you", "help"},
+	{"this", "is", "great"},
+	{"that", "is", "awesome"},
+}
+
+// compactEvery is how many entries the corpus log may hold before they
+// are folded into a new snapshot.
+const compactEvery = 200
+
+// corpusData is the corpus snapshot: the n-gram counts of everything the
+// user typed, counted at ngram.MaxOrder so any configured order can be
+// used with it.
+type corpusData struct {
+	Version int `json:"version"`
+	// Generation counts the snapshots written. A log only applies on top
+	// of the snapshot with its generation.
+	Generation int `json:"generation"`
+	// Decayed is when counts were last decayed.
+	Decayed time.Time    `json:"decayed"`
+	Model   *ngram.Model `json:"model"`
+	Forms   wordForms    `json:"forms,omitempty"`
+}
+
+// corpusEntry is one line of the corpus log: a header naming the
+// snapshot generation it follows, then one sentence or word per line, as
+// written and when.
+//
+// Every entry logged is also appended to the history, which compaction
+// leaves alone, so that purge can forget exactly what was learned in a
+// stretch of time. The history starts with an entry holding only the
+// time it was started.
+type corpusEntry struct {
+	Generation int       `json:"generation,omitempty"`
+	Time       time.Time `json:"time,omitzero"`
+	Sentence   []string  `json:"sentence,omitempty"`
+	Word       string    `json:"word,omitempty"`
+	Weight     float64   `json:"weight,omitempty"` // 1 if unset
+}
+
+// weight returns how much the entry counts.
+func (e corpusEntry) weight() float64 {
+	if e.Weight == 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+// corpusStore keeps the user's corpus as a snapshot, rewritten only now
+// and then, plus a log that each learned sentence is appended to. With no
+// files it only keeps the corpus in memory.
+type corpusStore struct {
+	files      *storage
+	limits     CorpusConfig
+	model      *ngram.Model // lowercase
+	forms      wordForms
+	generation int
+	logged     int         // entries in the log
+	decayed    time.Time   // when counts were last decayed
+	snapshot   os.FileInfo // the snapshot last read or written here
+}
+
+// openCorpus loads the user's corpus, migrating it from the files of
+// earlier versions the first time. With read-only storage it loads the
+// corpus as it would be, but writes nothing.
+func (g *Game) openCorpus() (*corpusStore, error) {
+	s := &corpusStore{limits: g.config.Corpus, model: ngram.New(ngram.MaxOrder), forms: wordForms{}}
+	if g.dataDir == "" {
+		return s, nil
+	}
+	s.files = g.files()
+
+	data, err := s.files.readFile(corpusFile)
+	if os.IsNotExist(err) {
+		if err := g.migrateCorpus(s); err != nil {
+			return nil, err
+		}
+		if s.files.readOnly {
+			return s, nil
+		}
+		// Write a snapshot even if there was nothing to migrate, so
+		// migration only ever runs once
+		if err := s.compact(); err != nil {
+			return nil, err
+		}
+		// The counts saved before the corpus store included the seed
+		// phrases and every sentence twice
+		if err := s.files.remove(modelFile); err != nil {
+			log.Printf("Error removing %s: %v", modelFile, err)
+		}
+		return s, s.startHistory()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.snapshot, err = s.files.stat(corpusFile); err != nil {
+		return nil, err
+	}
+
+	var stored corpusData
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("%s: %w", corpusFile, err)
+	}
+	if stored.Version > corpusVersion {
+		return nil, fmt.Errorf("%s: version %d is newer than this program", corpusFile, stored.Version)
+	}
+	if stored.Model != nil {
+		s.model = stored.Model
+	}
+	if stored.Forms != nil {
+		s.forms = stored.Forms
+	}
+	if stored.Version < 2 {
+		// Words typed live kept their case; count how they were
+		// written and fold them
+		for word, c := range s.model.Unigrams() {
+			s.forms.addWord(word, c)
+		}
+		s.model = s.model.Map(fold)
+	}
+	s.generation = stored.Generation
+	s.decayed = stored.Decayed
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	if s.files.readOnly {
+		return s, nil
+	}
+	if s.logged >= compactEvery || s.decayDue(time.Now()) {
+		if err := s.compact(); err != nil {
+			return nil, err
+		}
+	}
+	return s, s.startHistory()
+}
+
+// replay applies the entries logged since the snapshot. An entry cut
+// short by a crash at the end of the log is dropped, and a log left over
+// from before the snapshot is started afresh.
+func (s *corpusStore) replay() error {
+	data, err := s.files.readFile(corpusLogFile)
+	if os.IsNotExist(err) {
+		return s.startLog()
+	}
+	if err != nil {
+		return err
+	}
+
+	entries, good, err := readEntries(corpusLogFile, data)
+	if len(entries) > 0 && entries[0].Generation != s.generation {
+		// Already in the snapshot
+		return s.startLog()
+	}
+	if err != nil {
+		return err
+	}
+	if good == 0 {
+		return s.startLog()
+	}
+	if good < len(data) && !s.files.readOnly {
+		log.Printf("%s: dropping an entry cut short at the end", corpusLogFile)
+		if err := s.files.writeFile(corpusLogFile, data[:good]); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range entries[1:] {
+		s.apply(e)
+	}
+	s.logged = len(entries) - 1
+	return nil
+}
+
+// readEntries returns the corpus entries in data, one per line, and how
+// many bytes they take up. An entry cut short by a crash at the end is
+// left out. On a damaged entry, it returns the entries before it.
+func readEntries(name string, data []byte) ([]corpusEntry, int, error) {
+	var entries []corpusEntry
+	good := 0 // bytes of complete entries
+	for lineNum := 1; good < len(data); lineNum++ {
+		end := bytes.IndexByte(data[good:], '\n')
+		if end < 0 {
+			break // cut short while appending
+		}
+		var e corpusEntry
+		if err := json.Unmarshal(data[good:good+end], &e); err != nil {
+			if good+end+1 == len(data) {
+				break // cut short while appending
+			}
+			return entries, good, fmt.Errorf("%s:%d: %w", name, lineNum, err)
+		}
+		entries = append(entries, e)
+		good += end + 1
+	}
+	return entries, good, nil
+}
+
+// startHistory starts the history, if it hasn't been, or drops an entry
+// cut short by a crash at its end, so that what is appended next isn't
+// joined to it.
+func (s *corpusStore) startHistory() error {
+	data, err := s.files.readFile(corpusHistoryFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if good := bytes.LastIndexByte(data, '\n') + 1; good > 0 {
+		if good == len(data) {
+			return nil
+		}
+		log.Printf("%s: dropping an entry cut short at the end", corpusHistoryFile)
+		return s.files.writeFile(corpusHistoryFile, data[:good])
+	}
+	line, err := json.Marshal(corpusEntry{Time: time.Now()})
+	if err != nil {
+		return err
+	}
+	return s.files.writeFile(corpusHistoryFile, append(line, '\n'))
+}
+
+// readHistory returns when the history was started and its entries. A
+// history that was never started gives the zero time and no entries.
+func (s *corpusStore) readHistory() (time.Time, []corpusEntry, error) {
+	data, err := s.files.readFile(corpusHistoryFile)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil, nil
+	}
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	entries, _, err := readEntries(corpusHistoryFile, data)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	if len(entries) == 0 {
+		return time.Time{}, nil, nil
+	}
+	return entries[0].Time, entries[1:], nil
+}
+
+// startLog empties the log, leaving only its header.
+func (s *corpusStore) startLog() error {
+	s.logged = 0
+	if s.files.readOnly {
+		return nil
+	}
+	line, err := json.Marshal(corpusEntry{Generation: s.generation})
+	if err != nil {
+		return err
+	}
+	return s.files.writeFile(corpusLogFile, append(line, '\n'))
+}
+
+// errCorpusChanged is returned instead of overwriting a snapshot another
+// process wrote.
+var errCorpusChanged = errors.New("the corpus was changed by another process meanwhile")
+
+// compact applies the configured limits, writes the whole corpus as a
+// new snapshot and empties the log. It never overwrites a snapshot
+// another process wrote since this store read or wrote one, which would
+// lose what that process learned or forgot.
+func (s *corpusStore) compact() error {
+	if s.files == nil {
+		return nil
+	}
+	if s.changed() {
+		return errCorpusChanged
+	}
+	s.shrink(time.Now())
+
+	data, err := json.Marshal(corpusData{
+		Version:    corpusVersion,
+		Generation: s.generation + 1,
+		Decayed:    s.decayed,
+		Model:      s.model,
+		Forms:      s.forms,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.files.writeFile(corpusFile, data); err != nil {
+		return err
+	}
+	if s.snapshot, err = s.files.stat(corpusFile); err != nil {
+		return err
+	}
+	// A crash before the log is emptied leaves a log of the previous
+	// generation, which the next load ignores
+	s.generation++
+	return s.startLog()
+}
+
+// changed reports whether another process, such as purge or import, has
+// written a snapshot since this store last read or wrote one.
+func (s *corpusStore) changed() bool {
+	if s.files == nil || s.snapshot == nil {
+		return false
+	}
+	// Snapshots are renamed into place, so a new one is a new file,
+	// though it may reuse the inode of one long gone
+	info, err := s.files.stat(corpusFile)
+	return err == nil && (!os.SameFile(info, s.snapshot) || !info.ModTime().Equal(s.snapshot.ModTime()))
+}
+
+// decayFactor returns how much counts learned at t have decayed since.
+func (s *corpusStore) decayFactor(t time.Time) float64 {
+	if s.limits.HalfLifeDays <= 0 || !t.Before(s.decayed) {
+		return 1
+	}
+	days := s.decayed.Sub(t).Hours() / 24
+	return math.Pow(0.5, days/s.limits.HalfLifeDays)
+}
+
+// decayDue reports whether counts haven't been decayed for a day.
+func (s *corpusStore) decayDue(now time.Time) bool {
+	return s.limits.HalfLifeDays > 0 && now.Sub(s.decayed) > 24*time.Hour
+}
+
+// shrink drops forgotten n-grams, decays the counts for the time since
+// they last were, then drops n-grams seen about once if there are too
+// many, and finally the rarest ones beyond the size cap.
+func (s *corpusStore) shrink(now time.Time) {
+	// Forgotten sentences can leave counts at zero, or below if they
+	// were learned with different words
+	s.model.Prune(func(_, _ string, c float64) bool { return c <= 0 })
+
+	l := s.limits
+	if l.HalfLifeDays > 0 {
+		if !s.decayed.IsZero() && now.After(s.decayed) {
+			days := now.Sub(s.decayed).Hours() / 24
+			factor := math.Pow(0.5, days/l.HalfLifeDays)
+			s.model.Scale(factor)
+			s.forms.scale(factor)
+		}
+		s.decayed = now
+	}
+	if l.PruneAbove > 0 && s.model.Size() > l.PruneAbove {
+		n := s.model.Prune(func(_, _ string, c float64) bool { return c <= 1 })
+		log.Printf("Pruned %d n-grams seen about once", n)
+	}
+	if l.MaxNGrams > 0 && s.model.Size() > l.MaxNGrams {
+		n := s.model.Cap(l.MaxNGrams)
+		log.Printf("Pruned the %d rarest n-grams to stay under %d", n, l.MaxNGrams)
+	}
+	s.forms.prune(s.model.Unigrams())
+}
+
+// forget removes what was learned from from up to to from the corpus and
+// its history, as well as sentences typed before the history was started,
+// and compacts the corpus so that neither the snapshot nor the log keeps
+// them. It returns how many entries of the history it forgot.
+func (s *corpusStore) forget(from, to time.Time, older [][]string) (int, error) {
+	started, entries, err := s.readHistory()
+	if err != nil {
+		return 0, err
+	}
+	kept := []corpusEntry{{Time: started}}
+	forgotten := 0
+	for _, e := range entries {
+		if e.Time.Before(from) || !e.Time.Before(to) {
+			kept = append(kept, e)
+			continue
+		}
+		// Take away what is left of it after decay
+		e.Weight = -e.weight() * s.decayFactor(e.Time)
+		s.apply(e)
+		forgotten++
+	}
+	for _, sentence := range older {
+		s.add(sentence, -1)
+	}
+	if err := s.compact(); err != nil {
+		return 0, err
+	}
+
+	var history []byte
+	for _, e := range kept {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return 0, err
+		}
+		history = append(append(history, line...), '\n')
+	}
+	return forgotten, s.files.writeFile(corpusHistoryFile, history)
+}
+
+// merge adds many sentences to the corpus at once and compacts it,
+// rather than logging each.
+func (s *corpusStore) merge(sentences [][]string, weight float64) error {
+	for _, sentence := range sentences {
+		s.add(sentence, weight)
+	}
+	return s.compact()
+}
+
+// learn adds a sentence to the corpus.
+func (s *corpusStore) learn(sentence []string, weight float64) error {
+	return s.record(corpusEntry{Sentence: sentence, Weight: weight})
+}
+
+// learnWord adds a word on its own to the corpus.
+func (s *corpusStore) learnWord(word string, weight float64) error {
+	return s.record(corpusEntry{Word: word, Weight: weight})
+}
+
+// record applies an entry and appends it to the log and the history,
+// compacting the log once it is long enough.
+func (s *corpusStore) record(e corpusEntry) error {
+	s.apply(e)
+	if s.files == nil {
+		return nil
+	}
+
+	e.Time = time.Now()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if err := s.files.appendFile(corpusLogFile, line, true); err != nil {
+		return err
+	}
+	if err := s.files.appendFile(corpusHistoryFile, line, false); err != nil {
+		return err
+	}
+
+	s.logged++
+	if s.logged >= compactEvery {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *corpusStore) apply(e corpusEntry) {
+	weight := e.weight()
+	if e.Sentence != nil {
+		s.add(e.Sentence, weight)
+	}
+	if e.Word != "" {
+		s.model.AddWord(fold(e.Word), weight)
+		s.forms.addWord(e.Word, weight)
+	}
+}
+
+// add counts a sentence as written.
+func (s *corpusStore) add(sentence []string, weight float64) {
+	s.model.AddWeighted(foldSentence(sentence), weight)
+	s.forms.add(sentence, weight)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over
+// path, so path is never left half written. The rename is on disk before
+// it returns, so renames are never lost out of order: a new log must
+// never survive a power cut that the snapshot it follows doesn't.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir waits until the entries of a directory are on disk. Windows
+// can't open a directory to sync it, and needn't: its renames are
+// journaled.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+// migrateCorpus builds the corpus from the typed text and the training
+// sentences saved by earlier versions. Sentences ended with
+// Enter were saved to both, so a training sentence only counts if the
+// typed text doesn't already have it, and seed phrases that were saved
+// along with them don't count at all. Training sentences were saved with
+// their words as typed, punctuation and all, so they are split the way
+// the typed text is before they are compared or learned.
+func (g *Game) migrateCorpus(s *corpusStore) error {
+	typed, err := g.loadRawText()
+	if err != nil {
+		return err
+	}
+	saved, err := g.loadTrainingData()
+	if err != nil {
+		return err
+	}
+	var trained [][]string
+	for _, sentence := range saved {
+		trained = append(trained, parseRawText(strings.Join(sentence, " "))...)
+	}
+
+	unmatched := map[string]int{}
+	for _, sentence := range typed {
+		s.add(sentence, 1)
+		unmatched[sentenceKey(sentence)]++
+	}
+	seeds := map[string]bool{}
+	for _, sentence := range seedSentences {
+		seeds[sentenceKey(sentence)] = true
+	}
+	added := 0
+	for _, sentence := range trained {
+		key := sentenceKey(sentence)
+		if unmatched[key] > 0 {
+			unmatched[key]--
+			continue
+		}
+		if !seeds[key] {
+			s.add(sentence, 1)
+			added++
+		}
+	}
+	if len(typed) == 0 && len(trained) == 0 {
+		return nil
+	}
+	log.Printf("Migrated %d typed and %d more saved sentences to %s", len(typed), added, corpusFile)
+	return nil
+}
+
+// sentenceKey identifies a sentence regardless of case.
+func sentenceKey(sentence []string) string {
+	return strings.ToLower(strings.Join(sentence, " "))
+}
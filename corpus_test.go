@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForgetHistory(t *testing.T) {
+	dir := t.TempDir()
+	open := func() *corpusStore {
+		t.Helper()
+		g := &Game{dataDir: dir, config: defaultConfig()}
+		s, err := g.openCorpus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	s := open()
+	if err := s.learn([]string{"keep", "this"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	from := time.Now()
+	if err := s.learn([]string{"forget", "this"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.learnWord("Secret", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process purges what was learned since from
+	n, err := open().forget(from, time.Now().Add(time.Minute), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("forgot %d entries, want 2", n)
+	}
+	if !s.changed() {
+		t.Error("the first store didn't notice the purge")
+	}
+
+	s = open()
+	unigrams := s.model.Unigrams()
+	if unigrams["keep"] != 1 || unigrams["forget"] != 0 || unigrams["secret"] != 0 {
+		t.Errorf("after the purge, learned %v, want only keep this", unigrams)
+	}
+	if len(s.forms) != 0 {
+		t.Errorf("after the purge, remembered the forms %v", s.forms)
+	}
+	_, entries, err := s.readHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Sentence[0] != "keep" {
+		t.Errorf("history after the purge = %v, want only keep this", entries)
+	}
+}
+
+func TestReloadChangedCorpus(t *testing.T) {
+	dir := t.TempDir()
+	g := &Game{output: &recordingOutput{}, dataDir: dir, config: defaultConfig()}
+	g.initPrediction()
+	g.addSentence([]string{"purple", "elephants"}, 1)
+
+	other := &Game{dataDir: dir, config: defaultConfig()}
+	s, err := other.openCorpus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.forget(time.Time{}, time.Now().Add(time.Minute), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	g.reloadCorpus()
+	if got := g.model.Unigrams()["purple"]; got != 0 {
+		t.Errorf("the running game still knows a purged word %g times", got)
+	}
+	// What it learns next goes on top of the purged corpus
+	g.addSentence([]string{"green", "elephants"}, 1)
+	if err := g.corpus.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = other.openCorpus(); err != nil {
+		t.Fatal(err)
+	}
+	if unigrams := s.model.Unigrams(); unigrams["purple"] != 0 || unigrams["green"] != 1 {
+		t.Errorf("saved corpus has %v, want green elephants only", unigrams)
+	}
+}
+
+// TestReadOnlyCorpus checks that a corpus opened from read-only storage,
+// as for a dry run, knows what was learned but changes no files.
+func TestReadOnlyCorpus(t *testing.T) {
+	for _, name := range []string{"empty", "learned"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if name == "learned" {
+				s, err := (&Game{dataDir: dir, config: defaultConfig()}).openCorpus()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := s.learn([]string{"purple", "elephants"}, 1); err != nil {
+					t.Fatal(err)
+				}
+				// A torn entry at the end of the log
+				if err := s.files.appendFile(corpusLogFile, []byte(`{"sentence":["half`), false); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := readDir(t, dir)
+
+			store, err := openStorage(dir, defaultConfig().Storage, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := &Game{dataDir: dir, store: store, config: defaultConfig()}
+			s, err := g.openCorpus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.compact(); err == nil {
+				t.Error("compacted read-only storage")
+			}
+			if want := map[string]float64{"empty": 0, "learned": 1}[name]; s.model.Unigrams()["purple"] != want {
+				t.Errorf("knows purple %g times, want %g", s.model.Unigrams()["purple"], want)
+			}
+			if after := readDir(t, dir); !reflect.DeepEqual(after, before) {
+				t.Errorf("files changed from %v to %v", before, after)
+			}
+		})
+	}
+}
+
+// TestCompactChangedCorpus checks that a store doesn't overwrite a
+// snapshot another process wrote since it read its own.
+func TestCompactChangedCorpus(t *testing.T) {
+	dir := t.TempDir()
+	open := func() *corpusStore {
+		t.Helper()
+		s, err := (&Game{dataDir: dir, config: defaultConfig()}).openCorpus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	running := open()
+	other := open()
+	if err := other.learn([]string{"imported", "words"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := running.compact(); !errors.Is(err, errCorpusChanged) {
+		t.Errorf("compacting over the other snapshot: got %v, want %v", err, errCorpusChanged)
+	}
+	if got := open().model.Unigrams()["imported"]; got != 1 {
+		t.Errorf("saved corpus knows imported %g times, want 1", got)
+	}
+}
+
+// readDir returns the contents of the files in dir by name.
+func readDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = string(data)
+	}
+	return files
+}
+
+// TestMigrateCorpus checks that a sentence saved both to the typed text
+// and, with its words as typed, to the training sentences is learned
+// once, and that saved words are learned without their punctuation.
+func TestMigrateCorpus(t *testing.T) {
+	dir := t.TempDir()
+	g := &Game{dataDir: dir, config: defaultConfig()}
+	typed := "good night \nhi there. how are you\n"
+	if err := g.files().writeFile(rawTextFile, []byte(typed)); err != nil {
+		t.Fatal(err)
+	}
+	saved := `[["good","night",""],["hi","there.","how","are","you"],["an","old","sentence,","kept"],["hello","world"]]`
+	if err := g.files().writeFile(trainingDataFile, []byte(saved)); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := g.openCorpus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		context []string
+		word    string
+		want    float64
+	}{
+		{[]string{"good"}, "night", 1},
+		{[]string{"hi"}, "there", 1},
+		{[]string{"how", "are"}, "you", 1},
+		{[]string{"old"}, "sentence", 1},
+		{[]string{"sentence"}, "kept", 1},
+		{[]string{"hello"}, "world", 0},
+	}
+	for _, tt := range tests {
+		if got := s.model.Following(tt.context...)[tt.word]; got != tt.want {
+			t.Errorf("%q followed %v %g times, want %g", tt.word, tt.context, got, tt.want)
+		}
+	}
+	for word := range s.model.Unigrams() {
+		if strings.ContainsAny(word, ".,") || word == "" {
+			t.Errorf("learned the word %q", word)
+		}
+	}
+}
+
+// TestHistoryCutShort checks that more can be learned and purged after a
+// crash cut the last history entry short.
+func TestHistoryCutShort(t *testing.T) {
+	dir := t.TempDir()
+	open := func() *corpusStore {
+		t.Helper()
+		s, err := (&Game{dataDir: dir, config: defaultConfig()}).openCorpus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	s := open()
+	if err := s.learn([]string{"first", "sentence"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.files.appendFile(corpusHistoryFile, []byte(`{"sentence":["cut`), false); err != nil {
+		t.Fatal(err)
+	}
+
+	s = open()
+	for _, sentence := range [][]string{{"second", "sentence"}, {"third", "sentence"}} {
+		if err := s.learn(sentence, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, entries, err := s.readHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("history has %d entries, want 3", len(entries))
+	}
+	if _, err := s.forget(time.Time{}, time.Now().Add(time.Minute), nil); err != nil {
+		t.Errorf("purging: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/kidandcat/control
 go 1.24.1
 
 require (
+	github.com/go-vgo/robotgo v0.110.8
 	github.com/hajimehoshi/ebiten/v2 v2.8.8
 	golang.org/x/image v0.27.0
 )
@@ -14,11 +15,9 @@ require (
 	github.com/ebitengine/purego v0.8.3 // indirect
 	github.com/gen2brain/shm v0.1.1 // indirect
 	github.com/go-ole/go-ole v1.3.0 // indirect
-	github.com/go-vgo/robotgo v0.110.8 // indirect
 	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/jezek/xgb v1.1.1 // indirect
 	github.com/lufia/plan9stats v0.0.0-20250317134145-8bc96cf8fc35 // indirect
-	github.com/mb-14/gomarkov v0.0.0-20231120193207-9cbdc8df67a8 // indirect
 	github.com/otiai10/gosseract v2.2.1+incompatible // indirect
 	github.com/power-devops/perfstat v0.0.0-20240221224432-82ca36839d55 // indirect
 	github.com/robotn/xgb v0.10.0 // indirect
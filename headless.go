@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// runHeadless ticks the game without a window, tps times per second,
+// until the input runs out. Nothing is drawn; keystrokes still go to the
+// game's output.
+func runHeadless(g *Game, tps int) error {
+	ticker := time.NewTicker(time.Second / time.Duration(tps))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		f, err := g.input.Poll()
+		switch err {
+		case nil:
+			if !g.connected {
+				log.Printf("headless: gamepad connected")
+			}
+			g.connected = true
+			g.step(f)
+			if err := g.recordFrame(f); err != nil {
+				return err
+			}
+		case errNoGamepad:
+			if g.connected {
+				log.Printf("headless: gamepad disconnected")
+			}
+			g.connected = false
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// importFormats turn a file of each kind into plain text, with a line
+// break wherever a sentence must end.
+var importFormats = map[string]func(text string) string{
+	"text":     func(text string) string { return text },
+	"markdown": markdownText,
+	"history":  historyText,
+	"git":      gitLogText,
+}
+
+// runImport learns the sentences of existing text, so predictions are
+// useful before much has been typed. Imported text goes into the corpus
+// only, not the typed text. A running keyboard picks it up at its next
+// button press. A dry run changes nothing saved.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "auto", "text, markdown, history, git, or auto to tell by the file name")
+	weight := fs.Float64("weight", 1, "how much each imported sentence counts, compared to a typed one")
+	dryRun := fs.Bool("dry-run", false, "report what would be learned without learning it")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: import [-format FORMAT] [-weight W] [-dry-run] FILE...")
+	}
+	if *format != "auto" && importFormats[*format] == nil {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if *weight <= 0 {
+		return fmt.Errorf("weight must be positive, got %g", *weight)
+	}
+
+	var sentences [][]string
+	for _, path := range fs.Args() {
+		found, err := importFile(path, *format)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d sentences, %d words\n", path, len(found), countWords(found))
+		sentences = append(sentences, found...)
+	}
+
+	g, err := loadGame(*dryRun)
+	if err != nil {
+		return err
+	}
+	corpus, err := g.openCorpus()
+	if err != nil {
+		return err
+	}
+	unigrams := corpus.model.Unigrams()
+	newWords := map[string]bool{}
+	for _, sentence := range sentences {
+		for _, word := range sentence {
+			if unigrams[fold(word)] <= 0 {
+				newWords[fold(word)] = true
+			}
+		}
+	}
+	if *dryRun {
+		fmt.Printf("Would learn %d sentences of %d words, %d of them new words, each counting %g.\n",
+			len(sentences), countWords(sentences), len(newWords), *weight)
+		return nil
+	}
+	if err := corpus.merge(sentences, *weight); err != nil {
+		return err
+	}
+	fmt.Printf("Learned %d sentences of %d words, %d of them new words.\n",
+		len(sentences), countWords(sentences), len(newWords))
+	return nil
+}
+
+// importFile returns the sentences of one file, or of the git log of a
+// repository, with "-" for standard input.
+func importFile(path, format string) ([][]string, error) {
+	var data []byte
+	var err error
+	switch info, statErr := os.Stat(path); {
+	case path == "-":
+		data, err = io.ReadAll(os.Stdin)
+	case statErr == nil && info.IsDir():
+		if format != "auto" && format != "git" {
+			return nil, fmt.Errorf("%s: a directory can only be imported as a git repository", path)
+		}
+		format = "git"
+		data, err = exec.Command("git", "-C", path, "log", "--format=%B").Output()
+	default:
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if format == "auto" {
+		format = guessFormat(path)
+	}
+	return parseRawText(importFormats[format](string(data))), nil
+}
+
+// guessFormat tells the format of a file by its name.
+func guessFormat(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".md"), strings.HasSuffix(name, ".markdown"):
+		return "markdown"
+	case strings.HasSuffix(name, "history"):
+		return "history"
+	}
+	return "text"
+}
+
+func countWords(sentences [][]string) int {
+	n := 0
+	for _, sentence := range sentences {
+		n += len(sentence)
+	}
+	return n
+}
+
+var (
+	markdownImage  = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	markdownLink   = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	markdownHTML   = regexp.MustCompile(`<[^>]+>`)
+	markdownMarker = regexp.MustCompile(`^\s*(#+|>+|[-*+]|\d+[.)])\s+`)
+)
+
+// markdownText returns the prose of a Markdown document: code blocks,
+// tables, images and markup are dropped, and the lines of a paragraph
+// joined.
+func markdownText(text string) string {
+	var out strings.Builder
+	fenced := false
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+			out.WriteString("\n")
+			continue
+		}
+		if fenced || strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(trimmed, "|") {
+			out.WriteString("\n")
+			continue
+		}
+		// Headings and list items are sentences of their own
+		if markdownMarker.MatchString(line) {
+			out.WriteString("\n")
+			line = markdownMarker.ReplaceAllString(line, "")
+		}
+		if trimmed == "" {
+			out.WriteString("\n")
+			continue
+		}
+		line = markdownImage.ReplaceAllString(line, "")
+		line = markdownLink.ReplaceAllString(line, "$1")
+		line = markdownHTML.ReplaceAllString(line, "")
+		line = strings.NewReplacer("**", "", "__", "", "`", "", "*", "").Replace(line)
+		out.WriteString(line + " ")
+	}
+	return out.String()
+}
+
+// historyText returns the commands of a bash or zsh history file, one per
+// line, without zsh's timestamps and bash's timestamp comments.
+func historyText(text string) string {
+	var out strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		// : 1700000000:0;git status
+		if strings.HasPrefix(line, ": ") {
+			if _, command, ok := strings.Cut(line, ";"); ok {
+				line = command
+			}
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.String()
+}
+
+// gitLogTrailers are the lines at the end of a commit message that aren't
+// prose.
+var gitLogTrailers = regexp.MustCompile(`^[A-Z][A-Za-z-]*-by: `)
+
+// gitLogText returns the commit messages of "git log" output, with or
+// without its commit, author and date headers, one line per line of each
+// message.
+func gitLogText(text string) string {
+	var out strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "commit ") || strings.HasPrefix(line, "Merge: ") ||
+			strings.HasPrefix(line, "Author: ") || strings.HasPrefix(line, "Date: ") {
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if gitLogTrailers.MatchString(line) {
+			continue
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.String()
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Button is a gamepad button, numbered like ebiten's standard layout.
+type Button int
+
+const (
+	ButtonA      Button = iota // bottom face button
+	ButtonB                    // right face button
+	ButtonX                    // left face button
+	ButtonY                    // top face button
+	ButtonL1                   // front top left
+	ButtonR1                   // front top right
+	ButtonL2                   // front bottom left
+	ButtonR2                   // front bottom right
+	ButtonSelect               // center left
+	ButtonStart                // center right
+	ButtonL3                   // left stick click
+	ButtonR3                   // right stick click
+	ButtonUp                   // d-pad
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+	ButtonHome // center
+	buttonCount
+)
+
+var buttonNames = [buttonCount]string{
+	"A", "B", "X", "Y", "L1", "R1", "L2", "R2", "Select", "Start",
+	"L3", "R3", "Up", "Down", "Left", "Right", "Home",
+}
+
+func (b Button) String() string {
+	if b < 0 || b >= buttonCount {
+		return fmt.Sprintf("Button(%d)", int(b))
+	}
+	return buttonNames[b]
+}
+
+// parseButton returns the button with the given name, ignoring case.
+func parseButton(name string) (Button, bool) {
+	for b, n := range buttonNames {
+		if strings.EqualFold(n, name) {
+			return Button(b), true
+		}
+	}
+	return 0, false
+}
+
+// Buttons is a set of buttons.
+type Buttons uint32
+
+// Has reports whether b is in the set.
+func (s Buttons) Has(b Button) bool {
+	return s&(1<<b) != 0
+}
+
+// With returns the set with b added.
+func (s Buttons) With(b Button) Buttons {
+	return s | 1<<b
+}
+
+// InputFrame is the controller state for one frame.
+type InputFrame struct {
+	Time time.Time
+
+	// Stick axes in [-1, 1], with y pointing down.
+	LeftX, LeftY   float64
+	RightX, RightY float64
+
+	Held    Buttons // buttons down during this frame
+	Pressed Buttons // buttons that went down since the previous frame
+}
+
+// Press returns a copy of f with buttons held and just pressed.
+func (f InputFrame) Press(buttons ...Button) InputFrame {
+	for _, b := range buttons {
+		f.Held = f.Held.With(b)
+		f.Pressed = f.Pressed.With(b)
+	}
+	return f
+}
+
+// Hold returns a copy of f with buttons held but not just pressed.
+func (f InputFrame) Hold(buttons ...Button) InputFrame {
+	for _, b := range buttons {
+		f.Held = f.Held.With(b)
+	}
+	return f
+}
+
+// Stick returns a frame with the left stick pushed towards angle degrees,
+// measured clockwise from straight up, at the given magnitude.
+func Stick(angle, magnitude float64) InputFrame {
+	rad := angle * math.Pi / 180
+	return InputFrame{
+		LeftX: magnitude * math.Sin(rad),
+		LeftY: -magnitude * math.Cos(rad),
+	}
+}
+
+// errNoGamepad is returned by an InputSource while no controller is
+// connected.
+var errNoGamepad = errors.New("no gamepad connected")
+
+// InputSource delivers the controller state once per frame.
+type InputSource interface {
+	// Poll returns the state for the current frame. It returns
+	// errNoGamepad while no controller is connected and io.EOF once a
+	// finite source has nothing more to deliver.
+	Poll() (InputFrame, error)
+}
+
+// inputBackends are the sources selectable with the -input flag, given
+// as "name" or "name:argument".
+var inputBackends = map[string]func(arg string) (InputSource, error){
+	"ebiten": func(string) (InputSource, error) { return &ebitenInput{}, nil },
+	"script": func(path string) (InputSource, error) { return loadInputScript(path) },
+}
+
+// newInput creates the input source described by spec, e.g.
+// "script:session.txt" or "evdev:/dev/input/event5".
+func newInput(spec string) (InputSource, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	create, ok := inputBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown input %q", name)
+	}
+	return create(arg)
+}
+
+// scriptFrameInterval is the time between scripted frames without a Time,
+// matching ebiten's default 60 ticks per second.
+const scriptFrameInterval = time.Second / 60
+
+// scriptStart is the time of the first scripted or replayed frame.
+var scriptStart = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// scriptedInput replays a fixed sequence of frames, one per Poll. Frames
+// without a Time are stamped scriptFrameInterval apart, so replays don't
+// depend on the wall clock.
+type scriptedInput struct {
+	frames []InputFrame
+	start  time.Time
+	next   int
+}
+
+func newScriptedInput(frames ...InputFrame) *scriptedInput {
+	return &scriptedInput{frames: frames, start: scriptStart}
+}
+
+func (s *scriptedInput) Poll() (InputFrame, error) {
+	if s.next >= len(s.frames) {
+		return InputFrame{}, io.EOF
+	}
+	f := s.frames[s.next]
+	if f.Time.IsZero() {
+		f.Time = s.start.Add(time.Duration(s.next) * scriptFrameInterval)
+	}
+	s.next++
+	return f, nil
+}
+
+// loadInputScript reads a scripted session from a text file. Each line is
+// one frame:
+//
+//	LX LY RX RY [BUTTON...]
+//
+// Axes are numbers in [-1, 1]. Buttons are named as in buttonNames; a
+// plain name is held, a name prefixed with "+" is pressed on that frame.
+// "wait N" repeats the previous frame's sticks and held buttons for N
+// frames. Blank lines and lines starting with "#" are ignored.
+func loadInputScript(path string) (*scriptedInput, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var frames []InputFrame
+	var last InputFrame
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "wait" {
+			n, err := strconv.Atoi(strings.Join(fields[1:], " "))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%s:%d: wait needs a frame count", path, lineNum)
+			}
+			idle := last
+			idle.Pressed = 0
+			for range n {
+				frames = append(frames, idle)
+			}
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("%s:%d: want LX LY RX RY [BUTTON...]", path, lineNum)
+		}
+		var f InputFrame
+		axes := []*float64{&f.LeftX, &f.LeftY, &f.RightX, &f.RightY}
+		for i, axis := range axes {
+			if *axis, err = strconv.ParseFloat(fields[i], 64); err != nil {
+				return nil, fmt.Errorf("%s:%d: bad axis %q", path, lineNum, fields[i])
+			}
+		}
+		for _, name := range fields[4:] {
+			pressed := strings.HasPrefix(name, "+")
+			b, ok := parseButton(strings.TrimPrefix(name, "+"))
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: unknown button %q", path, lineNum, name)
+			}
+			if pressed {
+				f = f.Press(b)
+			} else {
+				f = f.Hold(b)
+			}
+		}
+		frames = append(frames, f)
+		last = f
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return newScriptedInput(frames...), nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// ebitenInput reads the first connected standard-layout gamepad through
+// ebiten. It must be polled from Game.Update.
+type ebitenInput struct {
+	gamepadIDsBuf []ebiten.GamepadID
+	gamepadIDs    map[ebiten.GamepadID]struct{}
+}
+
+func (e *ebitenInput) Poll() (InputFrame, error) {
+	if e.gamepadIDs == nil {
+		e.gamepadIDs = map[ebiten.GamepadID]struct{}{}
+	}
+
+	// Log the gamepad connection events.
+	e.gamepadIDsBuf = inpututil.AppendJustConnectedGamepadIDs(e.gamepadIDsBuf[:0])
+	for _, id := range e.gamepadIDsBuf {
+		log.Printf("gamepad connected: id: %d, SDL ID: %s", id, ebiten.GamepadSDLID(id))
+		e.gamepadIDs[id] = struct{}{}
+	}
+	for id := range e.gamepadIDs {
+		if inpututil.IsGamepadJustDisconnected(id) {
+			log.Printf("gamepad disconnected: id: %d", id)
+			delete(e.gamepadIDs, id)
+		}
+	}
+
+	ids := make([]ebiten.GamepadID, 0, len(e.gamepadIDs))
+	for id := range e.gamepadIDs {
+		if ebiten.IsStandardGamepadLayoutAvailable(id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return InputFrame{}, errNoGamepad
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	id := ids[0]
+
+	f := InputFrame{
+		Time:   time.Now(),
+		LeftX:  ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal),
+		LeftY:  ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical),
+		RightX: ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisRightStickHorizontal),
+		RightY: ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisRightStickVertical),
+	}
+	for b := Button(0); b < buttonCount; b++ {
+		sb := ebiten.StandardGamepadButton(b)
+		if ebiten.IsStandardGamepadButtonPressed(id, sb) {
+			f.Held = f.Held.With(b)
+		}
+		if inpututil.IsStandardGamepadButtonJustPressed(id, sb) {
+			f.Pressed = f.Pressed.With(b)
+			log.Printf("standard button pressed: id: %d, button: %d", id, b)
+			vibrate(id, b)
+		}
+		if inpututil.IsStandardGamepadButtonJustReleased(id, sb) {
+			log.Printf("standard button released: id: %d, button: %d", id, b)
+		}
+	}
+	return f, nil
+}
+
+// vibrate gives haptic feedback for face button and d-pad presses.
+func vibrate(id ebiten.GamepadID, b Button) {
+	var strong float64
+	var weak float64
+	switch b {
+	case ButtonUp, ButtonLeft, ButtonRight, ButtonDown:
+		weak = 0.5
+	case ButtonY, ButtonX, ButtonB, ButtonA:
+		strong = 0.5
+	}
+	if strong > 0 || weak > 0 {
+		op := &ebiten.VibrateGamepadOptions{
+			Duration:        200 * time.Millisecond,
+			StrongMagnitude: strong,
+			WeakMagnitude:   weak,
+		}
+		ebiten.VibrateGamepad(id, op)
+	}
+}
@@ -0,0 +1,227 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+func init() {
+	inputBackends["evdev"] = func(path string) (InputSource, error) { return openEvdevInput(path) }
+}
+
+// Absolute axis codes, from <linux/input-event-codes.h>.
+const (
+	absX     = 0x00
+	absY     = 0x01
+	absZ     = 0x02
+	absRX    = 0x03
+	absRY    = 0x04
+	absRZ    = 0x05
+	absHat0X = 0x10
+	absHat0Y = 0x11
+)
+
+// evdevButtons maps gamepad key codes to buttons, following the kernel's
+// Documentation/input/gamepad.rst.
+var evdevButtons = map[uint16]Button{
+	0x130: ButtonA,      // BTN_SOUTH
+	0x131: ButtonB,      // BTN_EAST
+	0x133: ButtonY,      // BTN_NORTH
+	0x134: ButtonX,      // BTN_WEST
+	0x136: ButtonL1,     // BTN_TL
+	0x137: ButtonR1,     // BTN_TR
+	0x138: ButtonL2,     // BTN_TL2
+	0x139: ButtonR2,     // BTN_TR2
+	0x13a: ButtonSelect, // BTN_SELECT
+	0x13b: ButtonStart,  // BTN_START
+	0x13c: ButtonHome,   // BTN_MODE
+	0x13d: ButtonL3,     // BTN_THUMBL
+	0x13e: ButtonR3,     // BTN_THUMBR
+	0x220: ButtonUp,     // BTN_DPAD_UP
+	0x221: ButtonDown,   // BTN_DPAD_DOWN
+	0x222: ButtonLeft,   // BTN_DPAD_LEFT
+	0x223: ButtonRight,  // BTN_DPAD_RIGHT
+}
+
+// absInfo mirrors struct input_absinfo.
+type absInfo struct {
+	Value, Minimum, Maximum, Fuzz, Flat, Resolution int32
+}
+
+// How long to wait between attempts to reopen an unplugged gamepad,
+// doubling from the first to the second.
+const (
+	evdevRetryMin = 250 * time.Millisecond
+	evdevRetryMax = 5 * time.Second
+)
+
+// evdevInput reads a gamepad straight from /dev/input/eventN, so it works
+// without a window or a display server. When the gamepad is unplugged it
+// keeps trying to reopen the same path; a /dev/input/by-id path keeps
+// naming the same gamepad when it comes back.
+type evdevInput struct {
+	path string
+	file *os.File // used by the read goroutine only
+
+	mu      sync.Mutex
+	abs     map[uint16]absInfo
+	state   InputFrame // sticks and held buttons
+	pressed Buttons    // buttons pressed since the last Poll
+	err     error      // set while the device can't be read, e.g. unplugged
+}
+
+func openEvdevInput(path string) (*evdevInput, error) {
+	f, abs, err := openEvdevDevice(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &evdevInput{path: path, file: f, abs: abs}
+	go e.read()
+	return e, nil
+}
+
+// openEvdevDevice opens the device at path and reads the range of its
+// absolute axes.
+func openEvdevDevice(path string) (*os.File, map[uint16]absInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	abs := map[uint16]absInfo{}
+	for _, code := range []uint16{absX, absY, absZ, absRX, absRY, absRZ} {
+		var info absInfo
+		// EVIOCGABS(code)
+		req := uintptr(0x80184540 + int(code))
+		if err := ioctl(f, req, uintptr(unsafe.Pointer(&info))); err == nil && info.Maximum > info.Minimum {
+			abs[code] = info
+		}
+	}
+	return f, abs, nil
+}
+
+// read applies events as they arrive, reopening the device whenever
+// reading it fails.
+func (e *evdevInput) read() {
+	for {
+		err := e.readEvents()
+		log.Printf("evdev: %v", err)
+		e.file.Close()
+		e.mu.Lock()
+		e.err = err
+		e.state = InputFrame{}
+		e.pressed = 0
+		e.mu.Unlock()
+		e.reopen()
+	}
+}
+
+// readEvents applies events until reading the device fails.
+func (e *evdevInput) readEvents() error {
+	size := binary.Size(inputEvent{})
+	buf := make([]byte, size*64)
+	for {
+		n, err := e.file.Read(buf)
+		if err != nil {
+			return err
+		}
+		e.mu.Lock()
+		r := bytes.NewReader(buf[:n])
+		var ev inputEvent
+		for binary.Read(r, binary.NativeEndian, &ev) == nil {
+			e.handle(ev)
+		}
+		e.mu.Unlock()
+	}
+}
+
+// reopen tries to open the device again, waiting longer after each
+// failure, until it succeeds.
+func (e *evdevInput) reopen() {
+	wait := evdevRetryMin
+	for {
+		time.Sleep(wait)
+		f, abs, err := openEvdevDevice(e.path)
+		if err == nil {
+			log.Printf("evdev: reopened %s", e.path)
+			e.file = f
+			e.mu.Lock()
+			e.abs = abs
+			e.err = nil
+			e.mu.Unlock()
+			return
+		}
+		wait = min(2*wait, evdevRetryMax)
+	}
+}
+
+// handle applies one event to the state. Called with mu held.
+func (e *evdevInput) handle(ev inputEvent) {
+	switch ev.Type {
+	case evKey:
+		if b, ok := evdevButtons[ev.Code]; ok && ev.Value != 2 { // 2 is autorepeat
+			e.setButton(b, ev.Value == 1)
+		}
+	case evAbs:
+		switch ev.Code {
+		case absX:
+			e.state.LeftX = e.axis(ev)
+		case absY:
+			e.state.LeftY = e.axis(ev)
+		case absRX:
+			e.state.RightX = e.axis(ev)
+		case absRY:
+			e.state.RightY = e.axis(ev)
+		case absZ:
+			// Analog triggers count as pressed past half travel.
+			e.setButton(ButtonL2, e.axis(ev) > 0)
+		case absRZ:
+			e.setButton(ButtonR2, e.axis(ev) > 0)
+		case absHat0X:
+			e.setButton(ButtonLeft, ev.Value < 0)
+			e.setButton(ButtonRight, ev.Value > 0)
+		case absHat0Y:
+			e.setButton(ButtonUp, ev.Value < 0)
+			e.setButton(ButtonDown, ev.Value > 0)
+		}
+	}
+}
+
+// axis scales an absolute axis value to [-1, 1].
+func (e *evdevInput) axis(ev inputEvent) float64 {
+	info, ok := e.abs[ev.Code]
+	if !ok {
+		return 0
+	}
+	return 2*float64(ev.Value-info.Minimum)/float64(info.Maximum-info.Minimum) - 1
+}
+
+func (e *evdevInput) setButton(b Button, down bool) {
+	if !down {
+		e.state.Held &^= 1 << b
+		return
+	}
+	if !e.state.Held.Has(b) {
+		e.pressed = e.pressed.With(b)
+	}
+	e.state.Held = e.state.Held.With(b)
+}
+
+func (e *evdevInput) Poll() (InputFrame, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return InputFrame{}, errNoGamepad
+	}
+	f := e.state
+	f.Time = time.Now()
+	f.Pressed = e.pressed
+	e.pressed = 0
+	return f, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStickPressA(t *testing.T) {
+	tests := []struct {
+		name             string
+		angle, magnitude float64
+		want             []OutputEvent
+	}{
+		// The outer ring's 26 letters are 360/26° apart, so 45° is
+		// nearest D; auto-shift capitalizes it at the start of a sentence
+		{"outer ring at 45°", 45, 1, []OutputEvent{{"type", "D"}}},
+		{"outer ring at 0°", 0, 1, []OutputEvent{{"type", "A"}}},
+		// The inner ring's 16 entries are 22.5° apart
+		{"inner ring at 45°", 45, 0.5, []OutputEvent{{"type", "2"}}},
+		{"inner ring backspace", 14 * 22.5, 0.5, []OutputEvent{{"tap", "backspace"}}},
+		{"deadzone", 45, 0.05, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stick := Stick(tt.angle, tt.magnitude)
+			out, err := replay(newScriptedInput(stick, stick.Press(ButtonA)), defaultConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out.Events, tt.want) {
+				t.Errorf("got %v, want %v", out.Events, tt.want)
+			}
+		})
+	}
+}
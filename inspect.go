@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kidandcat/control/ngram"
+)
+
+// inspectCommands look into what has been learned, to make sense of odd
+// predictions. They read the saved corpus without starting the keyboard,
+// and never change it.
+var inspectCommands = map[string]command{
+	"words":   {"words [-n N]: the most common words", inspectWords},
+	"next":    {"next [-n N] WORD...: the words that most often followed WORD..., " + ngram.Start + " for the start of a sentence", inspectNext},
+	"vocab":   {"vocab: how many different words are known", inspectVocab},
+	"predict": {"predict [-prefix P] [WORD...]: what the keyboard would offer after WORD..., completing P", inspectPredict},
+	"export":  {"export: print the whole corpus as JSON", inspectExport},
+}
+
+// runInspect runs one of inspectCommands.
+func runInspect(args []string) error {
+	if len(args) > 0 {
+		if cmd, ok := inspectCommands[args[0]]; ok {
+			return cmd.run(args[1:])
+		}
+	}
+	names := make([]string, 0, len(inspectCommands))
+	for name := range inspectCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var usage strings.Builder
+	usage.WriteString("usage: inspect COMMAND, one of:")
+	for _, name := range names {
+		usage.WriteString("\n  " + inspectCommands[name].usage)
+	}
+	return errors.New(usage.String())
+}
+
+// openSavedCorpus returns the user's corpus, read-only.
+func openSavedCorpus() (*corpusStore, error) {
+	g, err := loadGame(true)
+	if err != nil {
+		return nil, err
+	}
+	return g.openCorpus()
+}
+
+// printCounts prints the n words counted most often, with their counts
+// and share of the total.
+func printCounts(counts map[string]float64, n int) {
+	var top []ngram.Candidate
+	var total float64
+	for word, count := range counts {
+		top = ngram.Rank(top, ngram.Candidate{Word: word, Score: count}, n)
+		total += count
+	}
+	for _, c := range top {
+		fmt.Printf("%-20s %10.1f %6.2f%%\n", c.Word, c.Score, 100*c.Score/total)
+	}
+}
+
+func inspectWords(args []string) error {
+	fs := flag.NewFlagSet("inspect words", flag.ExitOnError)
+	n := fs.Int("n", 20, "how many words to show")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: inspect words [-n N]")
+	}
+	corpus, err := openSavedCorpus()
+	if err != nil {
+		return err
+	}
+	printCounts(corpus.model.Unigrams(), *n)
+	return nil
+}
+
+func inspectNext(args []string) error {
+	fs := flag.NewFlagSet("inspect next", flag.ExitOnError)
+	n := fs.Int("n", 20, "how many words to show")
+	fs.Parse(args)
+	if fs.NArg() == 0 || fs.NArg() >= ngram.MaxOrder {
+		return fmt.Errorf("usage: inspect next [-n N] WORD..., with 1 to %d words", ngram.MaxOrder-1)
+	}
+	corpus, err := openSavedCorpus()
+	if err != nil {
+		return err
+	}
+	following := corpus.model.Following(foldSentence(fs.Args())...)
+	if len(following) == 0 {
+		fmt.Printf("Nothing has followed %q.\n", strings.Join(fs.Args(), " "))
+		return nil
+	}
+	printCounts(following, *n)
+	return nil
+}
+
+func inspectVocab(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: inspect vocab")
+	}
+	corpus, err := openSavedCorpus()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d words\n", len(corpus.model.Unigrams()))
+	return nil
+}
+
+// inspectPredict offers predictions the way the keyboard does, from the
+// built-in phrases and the corpus at the configured order.
+func inspectPredict(args []string) error {
+	fs := flag.NewFlagSet("inspect predict", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "the start of the word being typed")
+	fs.Parse(args)
+
+	g, err := loadGame(true)
+	if err != nil {
+		return err
+	}
+	g.initRings()
+	g.sentence.words = append(fs.Args(), *prefix)
+	g.initPrediction()
+	if len(g.predictions) == 0 {
+		fmt.Println("No predictions.")
+	}
+	for i, c := range g.predictions {
+		fmt.Printf("%d. %-20s %.4f\n", i+1, c.Word, c.Score)
+	}
+	return nil
+}
+
+func inspectExport(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: inspect export")
+	}
+	corpus, err := openSavedCorpus()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(corpusData{
+		Version:    corpusVersion,
+		Generation: corpus.generation,
+		Decayed:    corpus.decayed,
+		Model:      corpus.model,
+		Forms:      corpus.forms,
+	})
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	keyringKey = secretServiceKey
+}
+
+// secretServiceAttributes identify the storage key in the Secret Service.
+var secretServiceAttributes = []string{"service", "control", "key", "storage"}
+
+// secretServiceKey returns the storage key from the Secret Service, the
+// keyring of GNOME and KDE, using secret-tool. The first time it stores a
+// new random key.
+func secretServiceKey() ([]byte, error) {
+	out, err := exec.Command("secret-tool", append([]string{"lookup"}, secretServiceAttributes...)...).Output()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("the storage key in the keyring is damaged")
+		}
+		return key, nil
+	case errors.As(err, &exit) && len(exit.Stderr) == 0:
+		// Nothing stored yet
+	default:
+		return nil, fmt.Errorf("reading the keyring with secret-tool: %w", err)
+	}
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	args := append([]string{"store", "--label=control storage key"}, secretServiceAttributes...)
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = strings.NewReader(base64.StdEncoding.EncodeToString(key))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("storing a key in the keyring with secret-tool: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return key, nil
+}
@@ -2,43 +2,70 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"image/color"
+	"io"
 	"log"
 	"math"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
-	"github.com/go-vgo/robotgo"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/text"
-	"github.com/mb-14/gomarkov"
+	"github.com/kidandcat/control/ngram"
+	"github.com/kidandcat/control/ring"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
 )
 
 const (
-	screenWidth  = 460  // Outer ring radius (200) * 2 + padding for characters
-	screenHeight = 460
-	trainingDataFile = "markov_training.json"
+	corpusFile       = "corpus.json"
+	corpusLogFile    = "corpus.log"
+	corpusHistoryFile = "corpus_history.log"
 	rawTextFile = "typed_text.txt"
+	
+	// Files written by versions before the corpus store
+	trainingDataFile = "markov_training.json"
+	modelFile        = "ngram_counts.json"
+	
+	// predictionSlots is how many predictions are offered: the best in
+	// the center and one on each side, picked with a right stick flick
+	predictionSlots = 3
+	
+	// A right stick push that is released within flickTime after going
+	// past flickMagnitude is a flick rather than moving the window
+	flickTime      = 200 * time.Millisecond
+	flickMagnitude = 0.7
+	
+	// Where the side predictions are drawn, relative to the center
+	predictionGap       = 8
+	predictionRowOffset = 40
+	
+	// Punctuation that smart punctuation puts right after an accepted
+	// prediction, in place of the space typed after it
+	closingPunctuation = ".,!?;:"
 )
 
 type Game struct {
-	gamepadIDsBuf  []ebiten.GamepadID
-	gamepadIDs     map[ebiten.GamepadID]struct{}
-	axes           map[ebiten.GamepadID][]string
-	pressedButtons map[ebiten.GamepadID][]string
+	// Where controller input comes from and keystrokes go
+	input     InputSource
+	output    Output
+	connected bool       // whether the input has a gamepad
+	frame     InputFrame // input for the current frame
 
 	// Ring keyboard state
-	rings          [2][2][]string // 2 rings, 2 sets (main/secondary)
-	currentSet     int            // 0 for main set, 1 for secondary set
-	selectedRing   int            // Which ring is active (0 or 1)
+	config         Config         // layout and settings from config.json
+	rings          [][][]string // entries of each ring of each set, innermost first
+	currentSet     int          // index of the set shown
+	selectedRing   int          // Which ring is active
 	selectedIndex  int
 	joystickAngle  float64
 	lastButtonTime time.Time
@@ -55,735 +82,675 @@ type Game struct {
 	windowY float64
 	windowInitialized bool
 	
-	// Markov chain for word prediction
-	markovChain    *gomarkov.Chain
-	currentSentence []string
+	// Right stick flick tracking
+	rightStickSince time.Time // when the stick left the dead zone
+	flickX, flickY  float64   // furthest the stick went along each axis
+	
+	// Where training data and typed text are kept; empty keeps
+	// everything in memory
+	dataDir string
+	store   *storage  // reads and writes dataDir, encrypted if configured
+	rawTextStamp time.Time // when the time was last marked in the raw text
+	
+	// Privacy: nothing is recorded or learned while incognito or while a
+	// denied window has focus
+	incognito bool
+	window    *windowWatcher
+	denied    bool // the focused window was denied as the frame was handled
+	paused    bool // learning was paused at the last check
+	framePaused bool // learning was paused as the frame was handled, before any toggle
+
+	// N-gram model for word prediction, of lowercase words, and how the
+	// user writes them
+	model           *ngram.Model
+	forms           wordForms
+	sentence        tokenizer // The sentence being typed
 	recentWords     []string  // Track recent words for training
-	trainingData    [][]string // All training sentences
-	nextPrediction  string     // Current word prediction to display
-	wordFrequency   map[string]int // Track word frequencies for autocomplete
+	corpus          *corpusStore // What was learned from the user, without the seed phrases
+	predictions     []ngram.Candidate // Word predictions to display, best first
+	vocabulary      *ngram.Trie // Lowercased word frequencies for autocomplete
+	neighbours      map[[2]rune]bool // Letters next to each other on a ring, for fuzzy completion
+	lastCorrection  *correction // Autocorrection the next button press can undo
+	predictionSpaced bool       // The space after an accepted prediction was typed last
+	letterOdds      map[rune]float64 // Chance of each letter coming next, for adaptive rings
 }
 
-// saveTrainingData saves all training sentences to a file
-func (g *Game) saveTrainingData() error {
-	// Get user's home directory
+// defaultDataDir returns ~/.config/control, where learned data is kept.
+func defaultDataDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return err
-	}
-	
-	configDir := filepath.Join(homeDir, ".config", "control")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return err
-	}
-	
-	filePath := filepath.Join(configDir, trainingDataFile)
-	data, err := json.Marshal(g.trainingData)
-	if err != nil {
-		return err
+		return "", err
 	}
-	
-	return os.WriteFile(filePath, data, 0644)
+	return filepath.Join(homeDir, ".config", "control"), nil
 }
 
-// loadTrainingData loads training sentences from file
-func (g *Game) loadTrainingData() error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return err
+// loadTrainingData loads the sentences saved by versions before the
+// corpus store
+func (g *Game) loadTrainingData() ([][]string, error) {
+	if g.dataDir == "" {
+		return nil, nil
 	}
 	
-	filePath := filepath.Join(homeDir, ".config", "control", trainingDataFile)
-	data, err := os.ReadFile(filePath)
+	data, err := g.files().readFile(trainingDataFile)
 	if err != nil {
 		if os.IsNotExist(err) {
-			// File doesn't exist yet, that's ok
-			g.trainingData = [][]string{}
-			return nil
+			// File doesn't exist, that's ok
+			return nil, nil
 		}
-		return err
+		return nil, err
 	}
 	
-	return json.Unmarshal(data, &g.trainingData)
+	var sentences [][]string
+	if err := json.Unmarshal(data, &sentences); err != nil {
+		return nil, fmt.Errorf("%s: %w", trainingDataFile, err)
+	}
+	return sentences, nil
 }
 
-// appendToRawText appends text to the raw text file
+// appendToRawText appends text to the raw text file, unless learning is
+// paused
 func (g *Game) appendToRawText(text string) error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return err
-	}
-	
-	configDir := filepath.Join(homeDir, ".config", "control")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return err
+	if g.dataDir == "" || !g.learning() {
+		return nil
 	}
 	
-	filePath := filepath.Join(configDir, rawTextFile)
-	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
+	// Mark the time now and then, so text can be purged by when it was typed
+	now := time.Now()
+	if now.Sub(g.rawTextStamp) >= rawTextStampInterval {
+		text = rawTextMark + now.UTC().Format(time.RFC3339) + "\n" + text
+		g.rawTextStamp = now
 	}
-	defer f.Close()
 	
-	_, err = f.WriteString(text)
-	return err
+	return g.files().appendFile(rawTextFile, []byte(text), false)
 }
 
-// loadRawTextAndTrain loads all previously typed text and trains the Markov chain
-func (g *Game) loadRawTextAndTrain() error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return err
+// loadRawText loads all previously typed text as sentences
+func (g *Game) loadRawText() ([][]string, error) {
+	if g.dataDir == "" {
+		return nil, nil
 	}
 	
-	filePath := filepath.Join(homeDir, ".config", "control", rawTextFile)
-	data, err := os.ReadFile(filePath)
+	data, err := g.files().readFile(rawTextFile)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// File doesn't exist yet, that's ok
-			return nil
+			return nil, nil
 		}
-		return err
-	}
-	
-	// Parse the text into sentences and words
-	text := string(data)
-	if text == "" {
-		return nil
+		return nil, err
 	}
-	
-	// Split by common sentence endings
-	sentences := strings.FieldsFunc(text, func(r rune) bool {
-		return r == '.' || r == '!' || r == '?' || r == '\n'
-	})
-	
-	// Process each sentence
-	for _, sentence := range sentences {
-		// Clean and split into words
-		sentence = strings.TrimSpace(sentence)
-		if sentence == "" {
-			continue
-		}
-		
-		// Split into words
-		words := strings.Fields(sentence)
-		if len(words) > 1 {
-			// Clean each word (remove punctuation except apostrophes)
-			cleanWords := make([]string, 0, len(words))
-			for _, word := range words {
-				// Remove trailing punctuation
-				word = strings.TrimRight(word, ",.;:\"'!?")
-				// Remove leading punctuation
-				word = strings.TrimLeft(word, "\"'")
-				if word != "" {
-					cleanWords = append(cleanWords, strings.ToLower(word))
-				}
-			}
-			
-			if len(cleanWords) > 1 {
-				g.markovChain.Add(cleanWords)
-			}
-			
-			// Add words to frequency map
-			for _, word := range cleanWords {
-				g.wordFrequency[word]++
-			}
+	return parseRawText(rawTextKeys(parseRawTextChunks(data))), nil
+}
+
+// parseRawText splits typed text into sentences of words as written,
+// leaving out sentences of a single word
+func parseRawText(text string) [][]string {
+	var result [][]string
+	var t tokenizer
+	for _, sentence := range append(t.write(text), t.end()) {
+		if len(sentence) > 1 {
+			result = append(result, sentence)
 		}
 	}
-	
-	log.Printf("Loaded and trained on raw text file (%d bytes)", len(data))
-	return nil
+	return result
 }
 
 // updatePrediction generates the next word prediction based on current context
 func (g *Game) updatePrediction() {
-	if g.markovChain == nil {
-		g.nextPrediction = ""
-		log.Printf("No prediction: markovChain is nil")
+	g.updateLetterOdds()
+
+	if g.model == nil {
+		g.predictions = nil
+		log.Printf("No prediction: model is nil")
 		return
 	}
 	
-	// If no sentence started yet, try to predict from empty context
-	if len(g.currentSentence) == 0 {
-		// Try to generate a starting word
-		next, err := g.markovChain.Generate([]string{""})
-		if err == nil && next != "" {
-			g.nextPrediction = next
-			log.Printf("Initial prediction: '%s'", next)
-		} else {
-			g.nextPrediction = ""
-			log.Printf("No initial prediction available")
+	// Complete a partial word, from both the words before it and how
+	// common each completion is
+	// Offer words the way the user writes them, capitalized at the start
+	// of a sentence with auto-shift
+	context := g.completeWords()
+	first := len(context) == 0 && g.config.Typing.autoShift()
+	if n := len(g.sentence.words); n > 0 && g.sentence.words[n-1] != "" {
+		currentWord := g.sentence.words[n-1]
+		g.predictions = g.complete(context, currentWord)
+		for i, c := range g.predictions {
+			g.predictions[i].Word = matchCase(currentWord, g.surface(c.Word, first))
 		}
+		g.logTyped("Autocompleting '%s' to %v", currentWord, g.predictions)
 		return
 	}
 	
-	// Check if we have a partial word being typed
-	currentWord := g.currentSentence[len(g.currentSentence)-1]
-	
-	// Use the appropriate context
-	var contextWord string
-	var isPartialWord bool
-	
-	
-	if currentWord == "" && len(g.currentSentence) > 1 {
-		// Just typed space, use previous complete word
-		contextWord = g.currentSentence[len(g.currentSentence)-2]
-		isPartialWord = false
-	} else if currentWord != "" {
-		// We have a partial or complete word
-		if len(g.currentSentence) > 1 {
-			// Use previous word as context for prediction
-			contextWord = g.currentSentence[len(g.currentSentence)-2]
-		} else {
-			// First word, try to predict based on partial
-			contextWord = currentWord
+	// Predict the next word from the complete words typed so far, backing
+	// off to shorter contexts down to the most common words overall
+	g.predictions = g.model.Top(context, predictionSlots)
+	for i, c := range g.predictions {
+		g.predictions[i].Word = g.surface(c.Word, first)
+	}
+	g.logTyped("Prediction updated: context=%v -> predictions=%v", context, g.predictions)
+}
+
+// completeWords returns the words of the current sentence before the one
+// being typed, as the model knows them.
+func (g *Game) completeWords() []string {
+	if len(g.sentence.words) == 0 {
+		return nil
+	}
+	var words []string
+	for _, word := range g.sentence.words[:len(g.sentence.words)-1] {
+		if word = normalizeWord(word); word != "" {
+			words = append(words, fold(word))
 		}
-		isPartialWord = true
-	}
-	
-	if contextWord != "" || isPartialWord {
-		if !isPartialWord || len(g.currentSentence) > 1 {
-			// Generate next word prediction based on previous word
-			next, err := g.markovChain.Generate([]string{contextWord})
-			if err == nil && next != "" {
-				g.nextPrediction = next
-				log.Printf("Prediction updated: context='%s' -> prediction='%s'", contextWord, next)
-			} else {
-				// If the exact word isn't known, try common follow-ups
-				log.Printf("No prediction for '%s', trying fallbacks", contextWord)
-				
-				// Try to find any word that commonly follows short words
-				if len(contextWord) <= 3 {
-					// For short words, try common patterns
-					commonFollowUps := []string{"the", "a", "is", "are", "and", "to", "in", "it", "that", "of"}
-					if len(commonFollowUps) > 0 {
-						// Pick a common word
-						g.nextPrediction = commonFollowUps[0]
-						log.Printf("Using fallback prediction: '%s'", g.nextPrediction)
-					} else {
-						g.nextPrediction = ""
-					}
-				} else {
-					// For longer unknown words, suggest common next words
-					g.nextPrediction = "the"
-					log.Printf("Using default prediction: '%s'", g.nextPrediction)
-				}
-			}
-		} else if isPartialWord && currentWord != "" {
-			// Autocomplete based on word frequency
-			lowerCurrent := strings.ToLower(currentWord)
-			var bestMatch string
-			maxFrequency := 0
-			
-			// Search for words that start with the current partial word
-			for word, freq := range g.wordFrequency {
-				if strings.HasPrefix(word, lowerCurrent) && word != lowerCurrent {
-					if freq > maxFrequency {
-						maxFrequency = freq
-						bestMatch = word
-					}
-				}
-			}
-			
-			if bestMatch != "" {
-				g.nextPrediction = bestMatch
-				log.Printf("Autocompleting '%s' to '%s' (frequency: %d)", currentWord, bestMatch, maxFrequency)
-			} else {
-				// No completion found in training data
-				g.nextPrediction = ""
-				log.Printf("No autocomplete found for '%s'", currentWord)
-			}
+	}
+	return words
+}
+
+// trackTyped follows typed text, backspaces and all, in the current
+// sentence, through the same tokenizer as saved text. It learns each
+// sentence it ends, and unlearns one a backspace reopens.
+func (g *Game) trackTyped(text string) {
+	for _, r := range text {
+		if sentence, change := g.sentence.writeRune(r); change != 0 {
+			g.learnSentence(sentence, float64(change))
 		}
-	} else {
-		g.nextPrediction = ""
-		log.Printf("No context word available")
 	}
 }
 
-func (g *Game) Update() error {
-	if g.gamepadIDs == nil {
-		g.gamepadIDs = map[ebiten.GamepadID]struct{}{}
+// learnSentence trains the model on a sentence weight times, if it has
+// more than one word and learning isn't paused, and saves it to the
+// corpus. Learning can't pause or resume without a new sentence, so a
+// reopened sentence is unlearned only if it was learned.
+func (g *Game) learnSentence(sentence []string, weight float64) {
+	if len(sentence) <= 1 || !g.learning() {
+		return
 	}
-	
+	g.addSentence(sentence, weight)
+}
+
+// addSentence counts a sentence weight more times, or fewer if weight is
+// negative, in the model and the corpus.
+func (g *Game) addSentence(sentence []string, weight float64) {
+	g.model.AddWeighted(foldSentence(sentence), weight)
+	g.forms.add(sentence, weight)
+	// Update word frequency
+	for _, word := range sentence {
+		g.vocabulary.Add(fold(word), weight)
+	}
+	if g.corpus != nil {
+		if err := g.corpus.learn(sentence, weight); err != nil {
+			log.Printf("Error saving corpus: %v", err)
+		}
+	}
+}
+
+func (g *Game) Update() error {
 	// Initialize window position on first frame
 	if !g.windowInitialized {
 		ebiten.SetWindowPosition(int(g.windowX), int(g.windowY))
 		g.windowInitialized = true
 	}
+
+	g.initRings()
+	g.initPrediction()
+
+	f, err := g.input.Poll()
+	g.connected = err == nil
+	if err == nil {
+		g.step(f)
+		g.moveWindow(f)
+		if err := g.recordFrame(f); err != nil {
+			return err
+		}
+	} else if err == io.EOF {
+		return ebiten.Termination
+	} else if err != errNoGamepad {
+		return err
+	}
 	
-	// Initialize Markov chain
-	if g.markovChain == nil {
-		g.markovChain = gomarkov.NewChain(1) // Order 1 chain (uses 1 previous word)
-		g.wordFrequency = make(map[string]int)
+	// Update opacity based on visibility toggle
+	if g.isVisible {
+		g.opacity = 1.0
+	} else {
+		g.opacity = 0.0
+	}
+
+	return nil
+}
+
+// moveWindow moves the window with the right joystick.
+func (g *Game) moveWindow(f InputFrame) {
+	// Handle right joystick for window movement
+	rightX := f.RightX
+	rightY := f.RightY
+	
+	// Apply dead zone, and wait until the push is too long to be a flick
+	if (math.Abs(rightX) > 0.1 || math.Abs(rightY) > 0.1) && f.Time.Sub(g.rightStickSince) > flickTime {
+		// Movement speed in pixels per frame
+		moveSpeed := 25.0
 		
-		// Load training data from file
-		if err := g.loadTrainingData(); err != nil {
-			log.Printf("Error loading training data: %v", err)
-		}
+		// Calculate new position
+		newX := g.windowX + rightX * moveSpeed
+		newY := g.windowY + rightY * moveSpeed
 		
-		// If no training data exists, start with some common phrases
-		if len(g.trainingData) == 0 {
-			g.trainingData = [][]string{
-				{"hello", "world"},
-				{"how", "are", "you"},
-				{"the", "quick", "brown", "fox"},
-				{"I", "am", "fine"},
-				{"thank", "you", "very", "much"},
-				{"what", "is", "your", "name"},
-				{"nice", "to", "meet", "you"},
-				{"have", "a", "good", "day"},
-				{"see", "you", "later"},
-				{"good", "morning"},
-				{"good", "afternoon"},
-				{"good", "evening"},
-				{"ok", "thanks"},
-				{"ok", "I", "will"},
-				{"ok", "let", "me", "check"},
-				{"ok", "sounds", "good"},
-				{"yes", "I", "agree"},
-				{"no", "thank", "you"},
-				{"please", "help", "me"},
-				{"can", "you", "help"},
-				{"this", "is", "great"},
-				{"that", "is", "awesome"},
-			}
-		}
+		// Get monitor bounds (we'll use the monitor work area)
+		monitorX, monitorY := ebiten.Monitor().Size()
 		
-		// Train the chain with all saved data
-		for _, sentence := range g.trainingData {
-			g.markovChain.Add(sentence)
-			// Add to word frequency
-			for _, word := range sentence {
-				g.wordFrequency[strings.ToLower(word)]++
-			}
+		// Clamp to screen boundaries
+		if newX < 0 {
+			newX = 0
 		}
-		log.Printf("Loaded %d training sentences", len(g.trainingData))
-		
-		// Load and train on all previously typed text
-		if err := g.loadRawTextAndTrain(); err != nil {
-			log.Printf("Error loading raw text: %v", err)
+		if newY < 0 {
+			newY = 0
 		}
-		
-		// Generate initial prediction
-		g.updatePrediction()
-	}
-
-	// Initialize ring keyboard with 2 rings and 2 sets
-	if g.rings[0][0] == nil {
-		// Main set (Set 0)
-		// Inner ring - numbers + common symbols (16 items)
-		g.rings[0][0] = []string{
-			"0", "1", "2", "3", "4", "5", "6", "7", "8", "9",
-			".", ",", "-", "_", "⌫", "↵",
+		size := g.config.Layout.screenSize()
+		if newX > float64(monitorX - size) {
+			newX = float64(monitorX - size)
 		}
-		// Outer ring - all letters (26 items)
-		g.rings[0][1] = []string{
-			"A", "B", "C", "D", "E", "F", "G", "H", "I", "J",
-			"K", "L", "M", "N", "O", "P", "Q", "R", "S", "T",
-			"U", "V", "W", "X", "Y", "Z",
+		if newY > float64(monitorY - size) {
+			newY = float64(monitorY - size)
 		}
 		
-		// Secondary set (Set 1) - coding symbols
-		// Inner ring - brackets and special chars (16 items)
-		g.rings[1][0] = []string{
-			"(", ")", "[", "]", "{", "}", "<", ">", "'", "\"",
-			"`", "~", "!", "?", "⌫", "↵",
-		}
-		// Outer ring - operators and symbols (26 items)
-		g.rings[1][1] = []string{
-			"+", "-", "*", "/", "=", "!=", "==", "&&", "||", "%",
-			"&", "|", "^", "<<", ">>", "@", "#", "$", ":", ";",
-			"\\", ".", ",", "_", "->", "=>",
-		}
-		g.font = basicfont.Face7x13
+		// Update window position
+		g.windowX = newX
+		g.windowY = newY
+		ebiten.SetWindowPosition(int(g.windowX), int(g.windowY))
+		
+		// Mark as having input
+		g.lastInputTime = f.Time
 	}
+}
 
-	// Log the gamepad connection events.
-	g.gamepadIDsBuf = inpututil.AppendJustConnectedGamepadIDs(g.gamepadIDsBuf[:0])
-	for _, id := range g.gamepadIDsBuf {
-		log.Printf("gamepad connected: id: %d, SDL ID: %s", id, ebiten.GamepadSDLID(id))
-		g.gamepadIDs[id] = struct{}{}
+// initPrediction builds the n-gram model from the seed phrases and the
+// corpus of everything learned from the user.
+func (g *Game) initPrediction() {
+	if g.model != nil {
+		return
 	}
-	for id := range g.gamepadIDs {
-		if inpututil.IsGamepadJustDisconnected(id) {
-			log.Printf("gamepad disconnected: id: %d", id)
-			delete(g.gamepadIDs, id)
-		}
+	g.model = ngram.New(g.config.Prediction.Order)
+	g.vocabulary = ngram.NewTrie(completionPool)
+	g.forms = wordForms{}
+	
+	for _, sentence := range seedSentences {
+		g.model.Add(foldSentence(sentence))
+		g.forms.add(sentence, 1)
 	}
+	
+	corpus, err := g.openCorpus()
+	if err != nil {
+		// Keep what is learned in memory rather than overwrite the corpus
+		log.Printf("Error loading corpus, not saving what is learned: %v", err)
+	} else {
+		g.corpus = corpus
+		g.model.Merge(corpus.model, 1)
+		g.forms.merge(corpus.forms)
+		st := corpus.model.Stats()
+		log.Printf("Loaded corpus: %d words, %d n-grams, about %s", st.NGrams[0], corpus.model.Size(), formatBytes(int64(st.Bytes)))
+	}
+	
+	// Word frequencies for autocomplete come from the unigram counts
+	for word, count := range g.model.Unigrams() {
+		g.vocabulary.Add(word, count)
+	}
+	
+	// Generate initial prediction
+	g.updatePrediction()
+}
 
-	g.axes = map[ebiten.GamepadID][]string{}
-	g.pressedButtons = map[ebiten.GamepadID][]string{}
-	for id := range g.gamepadIDs {
-		maxAxis := ebiten.GamepadAxisType(ebiten.GamepadAxisCount(id))
-		for a := range maxAxis {
-			v := ebiten.GamepadAxisValue(id, a)
-			g.axes[id] = append(g.axes[id], fmt.Sprintf("%d:%+0.2f", a, v))
-		}
-
-		maxButton := ebiten.GamepadButton(ebiten.GamepadButtonCount(id))
-		for b := ebiten.GamepadButton(0); b < maxButton; b++ {
-			if ebiten.IsGamepadButtonPressed(id, b) {
-				g.pressedButtons[id] = append(g.pressedButtons[id], strconv.Itoa(int(b)))
-			}
+// reloadCorpus rebuilds the model if another process wrote the corpus,
+// as purge and import do, so that what they forgot is forgotten here too
+// and what they learned is learned, rather than overwritten by the next
+// compaction.
+func (g *Game) reloadCorpus() {
+	if g.corpus == nil || !g.corpus.changed() {
+		return
+	}
+	log.Printf("The corpus was changed by another process, reloading it")
+	g.model = nil
+	g.corpus = nil
+	g.initPrediction()
+}
 
-			// Log button events.
-			if inpututil.IsGamepadButtonJustPressed(id, b) {
-				log.Printf("button pressed: id: %d, button: %d", id, b)
-			}
-			if inpututil.IsGamepadButtonJustReleased(id, b) {
-				log.Printf("button released: id: %d, button: %d", id, b)
-			}
+// initRings sets up the ring keyboard from the configured layout, or
+// the built-in one if none was loaded.
+func (g *Game) initRings() {
+	if g.rings != nil {
+		return
+	}
+	if len(g.config.Layout.Sets) == 0 {
+		g.config = defaultConfig()
+	}
+	g.rings = make([][][]string, len(g.config.Layout.Sets))
+	for s, set := range g.config.Layout.Sets {
+		for _, rc := range set.Rings {
+			g.rings[s] = append(g.rings[s], rc.Entries)
 		}
+	}
+	g.findNeighbours()
+	g.font = loadFont()
+}
 
-		if ebiten.IsStandardGamepadLayoutAvailable(id) {
-			for b := ebiten.StandardGamepadButton(0); b <= ebiten.StandardGamepadButtonMax; b++ {
-				// Log button events.
-				if inpututil.IsStandardGamepadButtonJustPressed(id, b) {
-					var strong float64
-					var weak float64
-					switch b {
-					case ebiten.StandardGamepadButtonLeftTop,
-						ebiten.StandardGamepadButtonLeftLeft,
-						ebiten.StandardGamepadButtonLeftRight,
-						ebiten.StandardGamepadButtonLeftBottom:
-						weak = 0.5
-					case ebiten.StandardGamepadButtonRightTop,
-						ebiten.StandardGamepadButtonRightLeft,
-						ebiten.StandardGamepadButtonRightRight,
-						ebiten.StandardGamepadButtonRightBottom:
-						strong = 0.5
-					}
-					if strong > 0 || weak > 0 {
-						op := &ebiten.VibrateGamepadOptions{
-							Duration:        200 * time.Millisecond,
-							StrongMagnitude: strong,
-							WeakMagnitude:   weak,
-						}
-						ebiten.VibrateGamepad(id, op)
-					}
-					log.Printf("standard button pressed: id: %d, button: %d", id, b)
-				}
-				if inpututil.IsStandardGamepadButtonJustReleased(id, b) {
-					log.Printf("standard button released: id: %d, button: %d", id, b)
-				}
-			}
+// loadFont returns Go Regular, which has accented letters such as ñ, ü
+// and ß, falling back to the built-in ASCII font.
+func loadFont() font.Face {
+	tt, err := opentype.Parse(goregular.TTF)
+	if err == nil {
+		var face font.Face
+		face, err = opentype.NewFace(tt, &opentype.FaceOptions{Size: 13, DPI: 72, Hinting: font.HintingFull})
+		if err == nil {
+			return face
 		}
+	}
+	log.Printf("Error loading font: %v", err)
+	return basicfont.Face7x13
+}
 
-		// Handle ring keyboard with left joystick
-		if ebiten.IsStandardGamepadLayoutAvailable(id) {
-			// Get left stick position
-			x := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
-			y := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
-
-			// Calculate angle and magnitude
-			magnitude := math.Sqrt(x*x + y*y)
-			
-			// Detect joystick movement
-			if magnitude > 0.1 {
-				g.lastInputTime = time.Now()
-			}
-
-			// Determine which ring based on magnitude
-			if magnitude > 0.1 {
-				if magnitude < 0.9 {
-					g.selectedRing = 0 // Inner ring (90% of range)
-				} else {
-					g.selectedRing = 1 // Outer ring (last 10%)
-				}
+// applyCase returns entry in the current case if it is a single letter,
+// and unchanged otherwise. Letters are uppercase while R1 is held and,
+// with auto-shift, at the start of a sentence.
+func (g *Game) applyCase(entry string) string {
+	r, size := utf8.DecodeRuneInString(entry)
+	if size != len(entry) || !unicode.IsLetter(r) {
+		return entry
+	}
+	if g.uppercase || g.config.Typing.autoShift() && g.sentenceStart() {
+		return strings.ToUpper(entry)
+	}
+	return strings.ToLower(entry)
+}
 
-				// Calculate angle from joystick position
-				// Atan2 gives angle from positive X axis, we need from positive Y axis
-				angle := math.Atan2(x, -y) // Note: x and -y are swapped to rotate 90 degrees
-				if angle < 0 {
-					angle += 2 * math.Pi
-				}
-				g.joystickAngle = angle
+// step advances the ring keyboard by one frame of controller input.
+func (g *Game) step(f InputFrame) {
+	g.initRings()
+	g.initPrediction()
+	g.frame = f
+	// Focus may have moved to a denied window since it was last checked,
+	// if that was a while ago
+	if f.Pressed != 0 {
+		g.window.check(windowMaxAge)
+	}
+	g.denied = g.window.Denied()
+	g.updateLearning()
+	g.framePaused = g.paused
+
+	// Only the very next button press can undo an autocorrection, or
+	// type punctuation in place of an accepted prediction's space
+	var undo *correction
+	var spaced bool
+	if f.Pressed != 0 {
+		g.reloadCorpus()
+		undo, g.lastCorrection = g.lastCorrection, nil
+		spaced, g.predictionSpaced = g.predictionSpaced, false
+	}
 
-				// Calculate selected character based on angle
-				currentRing := g.rings[g.currentSet][g.selectedRing]
-				segmentAngle := (2 * math.Pi) / float64(len(currentRing))
-				g.selectedIndex = int(angle/segmentAngle) % len(currentRing)
-			}
+	// Get left stick position
+	x := f.LeftX
+	y := f.LeftY
 
-			// Check for any button press
-			for b := ebiten.StandardGamepadButton(0); b <= ebiten.StandardGamepadButtonMax; b++ {
-				if ebiten.IsStandardGamepadButtonPressed(id, b) {
-					g.lastInputTime = time.Now()
-					break
-				}
-			}
-			
-			// Handle button press to select character
-			now := time.Now()
-			if inpututil.IsStandardGamepadButtonJustPressed(id, ebiten.StandardGamepadButtonRightBottom) {
-				// Debounce button presses
-				if now.Sub(g.lastButtonTime) > 200*time.Millisecond {
-					if magnitude > 0.1 { // Only select if joystick is moved
-						// Joystick moved - select from ring
-						currentRing := g.rings[g.currentSet][g.selectedRing]
-						if g.selectedIndex < len(currentRing) {
-							selectedChar := currentRing[g.selectedIndex]
-							if selectedChar == "⌫" { // Backspace
-								robotgo.KeyTap("backspace")
-								// Remove last character from current word
-								if len(g.currentSentence) > 0 {
-									lastWord := g.currentSentence[len(g.currentSentence)-1]
-									if len(lastWord) > 0 {
-										g.currentSentence[len(g.currentSentence)-1] = lastWord[:len(lastWord)-1]
-										if g.currentSentence[len(g.currentSentence)-1] == "" {
-											g.currentSentence = g.currentSentence[:len(g.currentSentence)-1]
-										}
-									}
-								}
-								g.updatePrediction()
-							} else if selectedChar == "↵" { // Enter
-								robotgo.KeyTap("enter")
-								// Save newline to raw text
-								if err := g.appendToRawText("\n"); err != nil {
-									log.Printf("Error saving newline: %v", err)
-								}
-								// Train markov chain with current sentence if it has words
-								if len(g.currentSentence) > 1 {
-									g.markovChain.Add(g.currentSentence)
-									g.trainingData = append(g.trainingData, append([]string{}, g.currentSentence...))
-									// Update word frequency
-									for _, word := range g.currentSentence {
-										if word != "" {
-											g.wordFrequency[strings.ToLower(word)]++
-										}
-									}
-									if err := g.saveTrainingData(); err != nil {
-										log.Printf("Error saving training data: %v", err)
-									}
-								}
-								g.currentSentence = []string{}
-							} else {
-								// Apply uppercase/lowercase transformation for letters
-								outputChar := selectedChar
-								if len(selectedChar) == 1 && selectedChar >= "A" && selectedChar <= "Z" {
-									if g.uppercase {
-										robotgo.TypeStr(selectedChar)
-									} else {
-										outputChar = strings.ToLower(selectedChar)
-										robotgo.TypeStr(outputChar)
-									}
-								} else {
-									robotgo.TypeStr(selectedChar)
-								}
-								
-								// Save typed character to raw text file
-								if err := g.appendToRawText(outputChar); err != nil {
-									log.Printf("Error saving typed text: %v", err)
-								}
-								
-								// Track the character for word building
-								if len(g.currentSentence) == 0 {
-									g.currentSentence = []string{""}
-								}
-								g.currentSentence[len(g.currentSentence)-1] += outputChar
-								log.Printf("Added char '%s' to word. Current sentence: %v", outputChar, g.currentSentence)
-								g.updatePrediction()
-							}
-							g.lastButtonTime = now
-						}
-					}
-				}
-			}
+	// Calculate angle and magnitude
+	magnitude := math.Sqrt(x*x + y*y)
+	
+	// Detect joystick movement
+	if magnitude > ring.Deadzone {
+		g.lastInputTime = f.Time
+	}
 
+	// Select the ring from the magnitude and the character from the angle
+	if ringIdx, index, ok := g.layout().Select(x, y); ok {
+		g.selectedRing = ringIdx
+		g.selectedIndex = index
+		g.joystickAngle = ring.Angle(x, y)
+	}
 
-			// Delete one character with B button (RightRight)
-			if inpututil.IsStandardGamepadButtonJustPressed(id, ebiten.StandardGamepadButtonRightRight) {
-				robotgo.KeyTap("backspace")
-				// Handle backspace for word tracking
-				if len(g.currentSentence) > 0 {
-					lastWord := g.currentSentence[len(g.currentSentence)-1]
-					if len(lastWord) > 0 {
-						g.currentSentence[len(g.currentSentence)-1] = lastWord[:len(lastWord)-1]
-						if g.currentSentence[len(g.currentSentence)-1] == "" {
-							g.currentSentence = g.currentSentence[:len(g.currentSentence)-1]
+	// Check for any button press
+	if f.Held != 0 {
+		g.lastInputTime = f.Time
+	}
+	
+	// Handle button press to select character
+	now := f.Time
+	if f.Pressed.Has(ButtonA) {
+		// Debounce button presses
+		if now.Sub(g.lastButtonTime) > 200*time.Millisecond {
+			if magnitude > ring.Deadzone { // Only select if joystick is moved
+				// Joystick moved - select from ring
+				currentRing := g.rings[g.currentSet][g.selectedRing]
+				if g.selectedIndex < len(currentRing) {
+					selectedChar := currentRing[g.selectedIndex]
+					if selectedChar == "⌫" { // Backspace
+						g.backspace(1)
+						g.updatePrediction()
+					} else if selectedChar == "↵" { // Enter
+						g.autocorrect("enter")
+						g.tapKey("enter")
+						// Save newline to raw text
+						if err := g.appendToRawText("\n"); err != nil {
+							log.Printf("Error saving newline: %v", err)
 						}
-					}
-				}
-				g.updatePrediction()
-			}
-
-			// Add space with X button (RightLeft)
-			if inpututil.IsStandardGamepadButtonJustPressed(id, ebiten.StandardGamepadButtonRightLeft) {
-				robotgo.TypeStr(" ")
-				// Save space to raw text
-				if err := g.appendToRawText(" "); err != nil {
-					log.Printf("Error saving space: %v", err)
-				}
-				// Start a new word
-				if len(g.currentSentence) > 0 && g.currentSentence[len(g.currentSentence)-1] != "" {
-					g.currentSentence = append(g.currentSentence, "")
-					log.Printf("Space pressed - new word started. Sentence: %v", g.currentSentence)
-				} else if len(g.currentSentence) == 0 {
-					// Start with empty word if no sentence yet
-					g.currentSentence = []string{""}
-				}
-				g.updatePrediction()
-			}
-			
-			// Add new line with Y button (RightTop)
-			if inpututil.IsStandardGamepadButtonJustPressed(id, ebiten.StandardGamepadButtonRightTop) {
-				robotgo.KeyTap("enter")
-				// Save newline to raw text
-				if err := g.appendToRawText("\n"); err != nil {
-					log.Printf("Error saving newline: %v", err)
-				}
-				// Train markov chain with current sentence if it has words
-				if len(g.currentSentence) > 1 {
-					g.markovChain.Add(g.currentSentence)
-					g.trainingData = append(g.trainingData, append([]string{}, g.currentSentence...))
-					// Update word frequency
-					for _, word := range g.currentSentence {
-						if word != "" {
-							g.wordFrequency[strings.ToLower(word)]++
+						// Train the model with the current sentence
+						g.trackTyped("\n")
+						g.updatePrediction()
+					} else if key, ok := namedKeys[selectedChar]; ok {
+						// Navigation keys don't change the sentence
+						g.tapKey(key)
+					} else {
+						// Apply uppercase/lowercase transformation for letters
+						outputChar := g.applyCase(selectedChar)
+						if spaced && g.config.Typing.smartPunctuation() && len(outputChar) == 1 && strings.Contains(closingPunctuation, outputChar) {
+							g.backspace(1)
 						}
-					}
-					if err := g.saveTrainingData(); err != nil {
-						log.Printf("Error saving training data: %v", err)
-					}
-				}
-				g.currentSentence = []string{}
-			}
-			
-			// D-pad arrow key mapping
-			if inpututil.IsStandardGamepadButtonJustPressed(id, ebiten.StandardGamepadButtonLeftTop) {
-				robotgo.KeyTap("up")
-			}
-			if inpututil.IsStandardGamepadButtonJustPressed(id, ebiten.StandardGamepadButtonLeftBottom) {
-				robotgo.KeyTap("down")
-			}
-			if inpututil.IsStandardGamepadButtonJustPressed(id, ebiten.StandardGamepadButtonLeftLeft) {
-				robotgo.KeyTap("left")
-			}
-			if inpututil.IsStandardGamepadButtonJustPressed(id, ebiten.StandardGamepadButtonLeftRight) {
-				robotgo.KeyTap("right")
-			}
-
-			// Hold L1/button 4 to show secondary character set
-			if ebiten.IsGamepadButtonPressed(id, ebiten.GamepadButton(4)) {
-				g.currentSet = 1 // Show secondary set while held
-			} else {
-				g.currentSet = 0 // Return to main set when released
-			}
-			
-			// Hold R1/button 5 for uppercase
-			if ebiten.IsGamepadButtonPressed(id, ebiten.GamepadButton(5)) {
-				g.uppercase = true // Uppercase while held
-			} else {
-				g.uppercase = false // Lowercase when released
-			}
-			
-			// R2/button 7 for accepting word prediction
-			if inpututil.IsStandardGamepadButtonJustPressed(id, ebiten.StandardGamepadButton(7)) {
-				log.Printf("R2 (button 7) pressed, prediction: '%s'", g.nextPrediction)
-				if g.nextPrediction != "" {
-					// Determine what to type based on current word state
-					var toType string
-					var currentWord string
-					
-					if len(g.currentSentence) > 0 && g.currentSentence[len(g.currentSentence)-1] != "" {
-						// We have a partial word - only type the completion
-						currentWord = g.currentSentence[len(g.currentSentence)-1]
-						if strings.HasPrefix(strings.ToLower(g.nextPrediction), strings.ToLower(currentWord)) {
-							// Prediction starts with current word, type only the rest
-							toType = g.nextPrediction[len(currentWord):] + " "
-						} else {
-							// Prediction doesn't match, replace the whole word
-							// First delete the current partial word
-							for i := 0; i < len(currentWord); i++ {
-								robotgo.KeyTap("backspace")
-							}
-							toType = g.nextPrediction + " "
+						g.typeStr(outputChar)
+						
+						// Save typed character to raw text file
+						if err := g.appendToRawText(outputChar); err != nil {
+							log.Printf("Error saving typed text: %v", err)
 						}
-					} else {
-						// No partial word, type the whole prediction
-						toType = g.nextPrediction + " "
+						
+						// Track the character for word building
+						g.trackTyped(outputChar)
+						g.logTyped("Added char '%s' to word. Current sentence: %v", outputChar, g.sentence.words)
+						g.updatePrediction()
 					}
-					
-					// Type the completion
-					robotgo.TypeStr(toType)
-					
-					// Save what was actually typed to raw text
-					if err := g.appendToRawText(toType); err != nil {
-						log.Printf("Error saving predicted word: %v", err)
-					}
-					
-					// Update sentence tracking with the complete word
-					if len(g.currentSentence) == 0 {
-						g.currentSentence = []string{g.nextPrediction, ""}
-					} else if g.currentSentence[len(g.currentSentence)-1] == "" {
-						g.currentSentence[len(g.currentSentence)-1] = g.nextPrediction
-						g.currentSentence = append(g.currentSentence, "")
-					} else {
-						// Update with the complete word
-						g.currentSentence[len(g.currentSentence)-1] = g.nextPrediction
-						g.currentSentence = append(g.currentSentence, "")
-					}
-					log.Printf("After prediction applied. Sentence: %v", g.currentSentence)
-					g.updatePrediction()
-				}
-			}
-			
-			// Handle right joystick for window movement
-			rightX := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisRightStickHorizontal)
-			rightY := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisRightStickVertical)
-			
-			// Apply dead zone
-			if math.Abs(rightX) > 0.1 || math.Abs(rightY) > 0.1 {
-				// Movement speed in pixels per frame
-				moveSpeed := 25.0
-				
-				// Calculate new position
-				newX := g.windowX + rightX * moveSpeed
-				newY := g.windowY + rightY * moveSpeed
-				
-				// Get monitor bounds (we'll use the monitor work area)
-				monitorX, monitorY := ebiten.Monitor().Size()
-				
-				// Clamp to screen boundaries
-				if newX < 0 {
-					newX = 0
-				}
-				if newY < 0 {
-					newY = 0
-				}
-				if newX > float64(monitorX - screenWidth) {
-					newX = float64(monitorX - screenWidth)
+					g.lastButtonTime = now
 				}
-				if newY > float64(monitorY - screenHeight) {
-					newY = float64(monitorY - screenHeight)
-				}
-				
-				// Update window position
-				g.windowX = newX
-				g.windowY = newY
-				ebiten.SetWindowPosition(int(g.windowX), int(g.windowY))
-				
-				// Mark as having input
-				g.lastInputTime = time.Now()
-			}
-			
-			// Button 9 to toggle visibility
-			if inpututil.IsGamepadButtonJustPressed(id, ebiten.GamepadButton(9)) {
-				g.isVisible = !g.isVisible
-				log.Printf("Visibility toggled: %v", g.isVisible)
 			}
 		}
 	}
+
+
+	// Delete one character with B button (RightRight), or undo an
+	// autocorrection just made
+	if f.Pressed.Has(ButtonB) && undo != nil {
+		g.undoCorrection(undo)
+	} else if f.Pressed.Has(ButtonB) {
+		g.backspace(1)
+		g.updatePrediction()
+	}
+
+	// Add space with X button (RightLeft)
+	if f.Pressed.Has(ButtonX) {
+		if len(g.sentence.words) > 0 && g.sentence.words[len(g.sentence.words)-1] != "" {
+			g.autocorrect("space")
+		}
+		g.typeStr(" ")
+		// Save space to raw text
+		if err := g.appendToRawText(" "); err != nil {
+			log.Printf("Error saving space: %v", err)
+		}
+		// Start a new word
+		g.trackTyped(" ")
+		g.logTyped("Space pressed - new word started. Sentence: %v", g.sentence.words)
+		g.updatePrediction()
+	}
 	
-	// Update opacity based on visibility toggle
-	if g.isVisible {
-		g.opacity = 1.0
+	// Add new line with Y button (RightTop)
+	if f.Pressed.Has(ButtonY) {
+		g.autocorrect("enter")
+		g.tapKey("enter")
+		// Save newline to raw text
+		if err := g.appendToRawText("\n"); err != nil {
+			log.Printf("Error saving newline: %v", err)
+		}
+		// Train the model with the current sentence
+		g.trackTyped("\n")
+		g.updatePrediction()
+	}
+	
+	// D-pad arrow key mapping
+	if f.Pressed.Has(ButtonUp) {
+		g.tapKey("up")
+	}
+	if f.Pressed.Has(ButtonDown) {
+		g.tapKey("down")
+	}
+	if f.Pressed.Has(ButtonLeft) {
+		g.tapKey("left")
+	}
+	if f.Pressed.Has(ButtonRight) {
+		g.tapKey("right")
+	}
+
+	// Switch character sets with L1/L2 (or the configured buttons)
+	g.updateSet(f)
+	
+	// Hold R1 for uppercase
+	if f.Held.Has(ButtonR1) {
+		g.uppercase = true // Uppercase while held
 	} else {
-		g.opacity = 0.0
+		g.uppercase = false // Lowercase when released
 	}
 	
-	return nil
+	// R2 accepts the best prediction, a right stick flick the one on
+	// that side
+	if f.Pressed.Has(ButtonR2) {
+		g.acceptPrediction(0)
+	}
+	switch g.updateFlick(f) {
+	case -1:
+		g.acceptPrediction(1)
+	case 1:
+		g.acceptPrediction(2)
+	}
+	
+	// Select+Start to toggle incognito, Start alone to toggle visibility
+	if f.Pressed.Has(ButtonStart) && f.Held.Has(ButtonSelect) {
+		g.incognito = !g.incognito
+		log.Printf("Incognito toggled: %v", g.incognito)
+		g.updateLearning()
+	} else if f.Pressed.Has(ButtonStart) {
+		g.isVisible = !g.isVisible
+		log.Printf("Visibility toggled: %v", g.isVisible)
+	}
+}
+
+// acceptPrediction types the prediction in the given slot, completing or
+// replacing the word being typed.
+func (g *Game) acceptPrediction(slot int) {
+	if slot >= len(g.predictions) {
+		return
+	}
+	word := g.predictions[slot].Word
+	g.logTyped("Accepting prediction %d: '%s'", slot, word)
+	g.lastCorrection = nil
+	// Determine what to type based on current word state
+	var toType string
+	var currentWord string
+	
+	if len(g.sentence.words) > 0 && g.sentence.words[len(g.sentence.words)-1] != "" {
+		// We have a partial word - only type the completion
+		currentWord = g.sentence.words[len(g.sentence.words)-1]
+		if strings.HasPrefix(word, currentWord) {
+			// Prediction starts with current word, type only the rest
+			toType = word[len(currentWord):] + " "
+		} else {
+			// Prediction doesn't match, or not in case, replace the whole word
+			// First delete the current partial word
+			g.backspace(utf8.RuneCountInString(currentWord))
+			toType = word + " "
+		}
+	} else {
+		// No partial word, type the whole prediction
+		toType = word + " "
+	}
+	
+	// Type the completion
+	g.typeStr(toType)
+	
+	// Save what was actually typed to raw text
+	if err := g.appendToRawText(toType); err != nil {
+		log.Printf("Error saving predicted word: %v", err)
+	}
+	
+	g.trackTyped(toType)
+	g.logTyped("After prediction applied. Sentence: %v", g.sentence.words)
+	g.predictionSpaced = true
+	g.updatePrediction()
+}
+
+// updateFlick tracks pushes of the right stick and returns -1 or 1 once
+// it is flicked left or right: pushed past flickMagnitude and released
+// within flickTime. Otherwise it returns 0.
+func (g *Game) updateFlick(f InputFrame) int {
+	if math.Abs(f.RightX) > ring.Deadzone || math.Abs(f.RightY) > ring.Deadzone {
+		if g.rightStickSince.IsZero() {
+			g.rightStickSince = f.Time
+			g.flickX, g.flickY = 0, 0
+		}
+		if math.Abs(f.RightX) > math.Abs(g.flickX) {
+			g.flickX = f.RightX
+		}
+		g.flickY = max(g.flickY, math.Abs(f.RightY))
+		return 0
+	}
+	if g.rightStickSince.IsZero() {
+		return 0
+	}
+	held := f.Time.Sub(g.rightStickSince)
+	g.rightStickSince = time.Time{}
+	if held > flickTime || math.Abs(g.flickX) < flickMagnitude || g.flickY > math.Abs(g.flickX) {
+		return 0
+	}
+	if g.flickX < 0 {
+		return -1
+	}
+	return 1
+}
+
+// updateSet picks the character set from the set-switch buttons: in
+// "hold" mode the set whose button is held, else the first set; in
+// "cycle" mode the next set on each press of the cycle button.
+func (g *Game) updateSet(f InputFrame) {
+	l := g.config.Layout
+	if l.SetSwitch == "cycle" {
+		if f.Pressed.Has(l.cycleButton) {
+			g.currentSet = (g.currentSet + 1) % len(g.rings)
+		}
+	} else {
+		g.currentSet = 0
+		for s, b := range l.holdButtons {
+			if b >= 0 && f.Held.Has(b) {
+				g.currentSet = s
+				break
+			}
+		}
+	}
+	if g.selectedRing >= len(g.rings[g.currentSet]) {
+		g.selectedRing = 0
+	}
+}
+
+// layout returns the geometry of the current character set, with each
+// ring's stick band and radius from the config and, with adaptive rings
+// on, wider segments for likely next letters.
+func (g *Game) layout() ring.Layout {
+	var l ring.Layout
+	for r, rc := range g.config.Layout.Sets[g.currentSet].Rings {
+		l.Sizes = append(l.Sizes, len(rc.Entries))
+		l.Radii = append(l.Radii, rc.Radius)
+		if r > 0 {
+			l.Bands = append(l.Bands, rc.Band)
+		}
+		l.Weights = append(l.Weights, g.letterWeights(rc.Entries))
+	}
+	return l
 }
 
 func (g *Game) applyOpacity(c color.RGBA) color.RGBA {
@@ -801,40 +768,29 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	}
 	
 	// Draw ring keyboard
-	centerX := float64(screenWidth / 2)
-	centerY := float64(screenHeight / 2)
+	screenSize := g.config.Layout.screenSize()
+	centerX := float64(screenSize / 2)
+	centerY := float64(screenSize / 2)
 
-	if len(g.gamepadIDs) > 0 {
+	if g.connected {
 		// Get current joystick magnitude first
-		var currentMagnitude float64
-		for id := range g.gamepadIDs {
-			if ebiten.IsStandardGamepadLayoutAvailable(id) {
-				x := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
-				y := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
-				currentMagnitude = math.Sqrt(x*x + y*y)
-				break
-			}
-		}
-
-		// Define radii for the 2 rings
-		radii := [2]float64{120, 200}
+		currentMagnitude := math.Hypot(g.frame.LeftX, g.frame.LeftY)
 
-		// Draw all 2 rings - from outer to inner to prevent overlap
-		for ringIdx := 1; ringIdx >= 0; ringIdx-- {
-			ring := g.rings[g.currentSet][ringIdx]
-			radius := radii[ringIdx]
+		layout := g.layout()
 
+		// Draw all rings - from outer to inner to prevent overlap
+		for ringIdx := len(g.rings[g.currentSet]) - 1; ringIdx >= 0; ringIdx-- {
+			entries := g.rings[g.currentSet][ringIdx]
 
 			// Draw characters in this ring
-			for i, char := range ring {
-				// Start from top (12 o'clock) by subtracting Pi/2
-				angle := float64(i)*(2*math.Pi)/float64(len(ring)) - math.Pi/2
-				x := centerX + radius*math.Cos(angle)
-				y := centerY + radius*math.Sin(angle)
+			for i, char := range entries {
+				dx, dy := layout.Position(ringIdx, i)
+				x := centerX + dx
+				y := centerY + dy
 
 				// Highlight selected character in active ring
 				textColor := g.applyOpacity(color.RGBA{150, 150, 150, 255})              // Dimmer for inactive rings
-				if currentMagnitude > 0.1 && ringIdx == g.selectedRing { // Only highlight if joystick is moved
+				if currentMagnitude > ring.Deadzone && ringIdx == g.selectedRing { // Only highlight if joystick is moved
 					textColor = g.applyOpacity(color.RGBA{255, 255, 255, 255})
 					if i == g.selectedIndex {
 						textColor = g.applyOpacity(color.RGBA{0, 255, 255, 255}) // Cyan for selected
@@ -845,24 +801,18 @@ func (g *Game) Draw(screen *ebiten.Image) {
 
 				// Draw character with background circle for visibility
 				// Different color for each ring
-				bgColors := [2]color.RGBA{
-					{80, 40, 40, 255}, // Dark red for inner
-					{40, 40, 80, 255}, // Dark blue for outer
-				}
-				bgColor := bgColors[ringIdx]
-				if currentMagnitude > 0.1 && ringIdx == g.selectedRing { // Only brighten if joystick is moved
-					bgColor.R += 50
-					bgColor.G += 50
-					bgColor.B += 50
+				bgColor := g.config.Layout.Sets[g.currentSet].Rings[ringIdx].rgba
+				if currentMagnitude > ring.Deadzone && ringIdx == g.selectedRing { // Only brighten if joystick is moved
+					bgColor.R = uint8(min(int(bgColor.R)+50, 255))
+					bgColor.G = uint8(min(int(bgColor.G)+50, 255))
+					bgColor.B = uint8(min(int(bgColor.B)+50, 255))
 				}
 				ebitenutil.DrawCircle(screen, x, y, 18, g.applyOpacity(bgColor))
 
 				// Draw character with case transformation
-				displayChar := char
-				if len(char) == 1 && char >= "A" && char <= "Z" {
-					if !g.uppercase {
-						displayChar = strings.ToLower(char)
-					}
+				displayChar := g.applyCase(char)
+				if label, ok := keyLabels[char]; ok {
+					displayChar = label
 				}
 				bounds := text.BoundString(g.font, displayChar)
 				textX := int(x) - bounds.Dx()/2
@@ -871,44 +821,137 @@ func (g *Game) Draw(screen *ebiten.Image) {
 			}
 		}
 
-		// Draw predicted word in the center
-		if g.nextPrediction != "" {
-			// Create a background for better visibility
-			bgColor := g.applyOpacity(color.RGBA{40, 40, 40, 200})
-			predBounds := text.BoundString(g.font, g.nextPrediction)
-			padding := 10
-			bgX := int(centerX) - predBounds.Dx()/2 - padding
-			bgY := int(centerY) - predBounds.Dy()/2 - padding
-			bgW := predBounds.Dx() + padding*2
-			bgH := predBounds.Dy() + padding*2
-			
-			// Draw background rectangle
-			for y := bgY; y < bgY+bgH; y++ {
-				for x := bgX; x < bgX+bgW; x++ {
-					screen.Set(x, y, bgColor)
-				}
+		// Draw the best prediction in the center, with the ones picked by
+		// flicking left and right below it on each side
+		for slot, p := range g.predictions {
+			bounds := text.BoundString(g.font, p.Word)
+			x := int(centerX) - bounds.Dx()/2
+			y := int(centerY)
+			textColor := color.RGBA{0, 255, 0, 255}
+			switch slot {
+			case 1:
+				x = int(centerX) - predictionGap - bounds.Dx()
+				y += predictionRowOffset
+				textColor = color.RGBA{0, 180, 0, 255}
+			case 2:
+				x = int(centerX) + predictionGap
+				y += predictionRowOffset
+				textColor = color.RGBA{0, 180, 0, 255}
 			}
-			
-			// Draw the predicted word
-			predX := int(centerX) - predBounds.Dx()/2
-			predY := int(centerY) + predBounds.Dy()/2
-			text.Draw(screen, g.nextPrediction, g.font, predX, predY, g.applyOpacity(color.RGBA{0, 255, 0, 255}))
+			g.drawPrediction(screen, p.Word, x, y, textColor)
 		}
 
 	} else {
 		str := "Please connect your gamepad."
 		bounds := text.BoundString(g.font, str)
-		text.Draw(screen, str, g.font, (screenWidth-bounds.Dx())/2, screenHeight/2, g.applyOpacity(color.RGBA{255, 255, 255, 255}))
+		text.Draw(screen, str, g.font, (screenSize-bounds.Dx())/2, screenSize/2, g.applyOpacity(color.RGBA{255, 255, 255, 255}))
 	}
+	
+	g.drawPrivacy(screen)
+}
+
+// drawPrediction draws a predicted word on a dark background, with its
+// left edge at x and vertically centered on y.
+func (g *Game) drawPrediction(screen *ebiten.Image, word string, x, y int, textColor color.RGBA) {
+	// Create a background for better visibility
+	bgColor := g.applyOpacity(color.RGBA{40, 40, 40, 200})
+	bounds := text.BoundString(g.font, word)
+	padding := 10
+	bgX := x - padding
+	bgY := y - bounds.Dy()/2 - padding
+	bgW := bounds.Dx() + padding*2
+	bgH := bounds.Dy() + padding*2
+	
+	// Draw background rectangle
+	for py := bgY; py < bgY+bgH; py++ {
+		for px := bgX; px < bgX+bgW; px++ {
+			screen.Set(px, py, bgColor)
+		}
+	}
+	
+	// Draw the predicted word
+	text.Draw(screen, word, g.font, x, y+bounds.Dy()/2, g.applyOpacity(textColor))
 }
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
-	return screenWidth, screenHeight
+	size := g.config.Layout.screenSize()
+	return size, size
 }
 
 func main() {
-	ebiten.SetWindowSize(screenWidth, screenHeight)
-	ebiten.SetWindowTitle("Ring Keyboard Controller - 2 Rings with L1 Toggle")
+	outputName := flag.String("output", "robotgo", "keystroke output backend ("+strings.Join(outputNames(), ", ")+")")
+	inputSpec := flag.String("input", "ebiten", "controller input: ebiten, evdev:DEVICE or script:FILE")
+	headless := flag.Bool("headless", false, "run without a window, reading -input on a timer")
+	tps := flag.Int("tps", ebiten.DefaultTPS, "ticks per second in headless mode")
+	recordFile := flag.String("record", "", "record controller input to `file` for later replay")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *tps < 1 || *tps > 1000 {
+		log.Fatalf("-tps must be between 1 and 1000, got %d", *tps)
+	}
+
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	input, err := newInput(*inputSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, ok := input.(*ebitenInput); ok && *headless {
+		log.Fatal("headless mode needs -input evdev:DEVICE or -input script:FILE")
+	}
+
+	output, err := newOutput(*outputName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if closer, ok := output.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	dataDir, err := defaultDataDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	config, err := loadConfig(dataDir)
+	if err != nil {
+		log.Printf("Error loading config, using the built-in layout: %v", err)
+	}
+	if err := checkLayout(output, config.Layout); err != nil {
+		log.Fatalf("-output %s: %v", *outputName, err)
+	}
+	store, err := openStorage(dataDir, config.Storage, false)
+	if err != nil {
+		// Neither mix plaintext with encrypted data nor lose either
+		log.Printf("Error opening saved data, nothing will be loaded or saved: %v", err)
+		dataDir = ""
+	}
+
+	if *recordFile != "" {
+		rec, err := newInputRecorder(input, *recordFile, config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rec.Close()
+		input = rec
+	}
+
+	if *headless {
+		game := &Game{input: input, output: output, dataDir: dataDir, store: store, config: config}
+		game.window = newWindowWatcher(config.Privacy.DenyWindows)
+		if err := runHeadless(game, *tps); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	ebiten.SetWindowSize(config.Layout.screenSize(), config.Layout.screenSize())
+	ebiten.SetWindowTitle("Ring Keyboard Controller")
 	ebiten.SetWindowDecorated(false)
 	ebiten.SetScreenTransparent(true)
 	ebiten.SetWindowFloating(true)
@@ -919,6 +962,12 @@ func main() {
 		windowX: 100.0,  // Default starting position
 		windowY: 100.0,
 		isVisible: true, // Start visible
+		input:     input,
+		output:    output,
+		dataDir:   dataDir,
+		store:     store,
+		config:    config,
+		window:    newWindowWatcher(config.Privacy.DenyWindows),
 	}
 	
 	if err := ebiten.RunGame(game); err != nil {
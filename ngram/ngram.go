@@ -0,0 +1,375 @@
+// Package ngram is a word n-gram language model with stupid backoff.
+package ngram
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Start is the token before the first word of every sentence, so the
+// model can predict how sentences begin.
+const Start = "<s>"
+
+// DefaultOrder is the n-gram order used when none is configured: each
+// word is predicted from up to two words before it.
+const DefaultOrder = 3
+
+// MaxOrder is the highest order a model can usefully be queried at.
+const MaxOrder = 4
+
+// backoff is the penalty applied each time scoring falls back to a
+// shorter context, as in Brants et al.'s stupid backoff.
+const backoff = 0.4
+
+// Model counts how often each word follows each context of up to
+// Order-1 words.
+type Model struct {
+	order  int
+	counts map[string]map[string]float64 // context words joined by spaces → next word → count
+	totals map[string]float64            // context → sum of its counts
+}
+
+// New returns an empty model of the given order, at least 1.
+func New(order int) *Model {
+	if order < 1 {
+		order = DefaultOrder
+	}
+	return &Model{
+		order:  order,
+		counts: map[string]map[string]float64{},
+		totals: map[string]float64{},
+	}
+}
+
+// Order returns the length of the longest n-grams the model counts.
+func (m *Model) Order() int {
+	return m.order
+}
+
+// Add counts every n-gram of sentence once.
+func (m *Model) Add(sentence []string) {
+	m.AddWeighted(sentence, 1)
+}
+
+// AddWeighted counts every n-gram of sentence with the given weight.
+func (m *Model) AddWeighted(sentence []string, weight float64) {
+	words := append([]string{Start}, sentence...)
+	for i := 1; i < len(words); i++ {
+		if words[i] == "" {
+			continue
+		}
+		for n := 0; n < m.order && n <= i; n++ {
+			if n > 0 && words[i-n] == "" {
+				break
+			}
+			m.add(strings.Join(words[i-n:i], " "), words[i], weight)
+		}
+	}
+}
+
+// AddWord counts word on its own, outside of any sentence.
+func (m *Model) AddWord(word string, weight float64) {
+	m.add("", word, weight)
+}
+
+func (m *Model) add(context, word string, weight float64) {
+	next := m.counts[context]
+	if next == nil {
+		next = map[string]float64{}
+		m.counts[context] = next
+	}
+	next[word] += weight
+	m.totals[context] += weight
+}
+
+// Merge adds the counts of other, times weight, to m, leaving out
+// contexts too long for m's order.
+func (m *Model) Merge(other *Model, weight float64) {
+	for context, next := range other.counts {
+		if contextLen(context) >= m.order {
+			continue
+		}
+		for word, c := range next {
+			m.add(context, word, c*weight)
+		}
+	}
+}
+
+// Map returns a copy of m with every word replaced by f(word), adding up
+// the counts of n-grams that become the same. Start is left as it is.
+func (m *Model) Map(f func(word string) string) *Model {
+	mapped := New(m.order)
+	mapWord := func(word string) string {
+		if word == Start {
+			return word
+		}
+		return f(word)
+	}
+	for context, next := range m.counts {
+		words := strings.Fields(context)
+		for i, word := range words {
+			words[i] = mapWord(word)
+		}
+		key := strings.Join(words, " ")
+		for word, c := range next {
+			mapped.add(key, mapWord(word), c)
+		}
+	}
+	return mapped
+}
+
+// Scale multiplies every count by factor.
+func (m *Model) Scale(factor float64) {
+	for context, next := range m.counts {
+		for word := range next {
+			next[word] *= factor
+		}
+		m.totals[context] *= factor
+	}
+}
+
+// Prune removes the n-grams that drop returns true for, given the
+// context as words joined by spaces, and returns how many it removed.
+func (m *Model) Prune(drop func(context, word string, count float64) bool) int {
+	removed := 0
+	for context, next := range m.counts {
+		for word, c := range next {
+			if drop(context, word, c) {
+				delete(next, word)
+				m.totals[context] -= c
+				removed++
+			}
+		}
+		if len(next) == 0 {
+			delete(m.counts, context)
+			delete(m.totals, context)
+		}
+	}
+	return removed
+}
+
+// Size returns the number of n-grams counted.
+func (m *Model) Size() int {
+	n := 0
+	for _, next := range m.counts {
+		n += len(next)
+	}
+	return n
+}
+
+// Cap removes the rarest n-grams until at most max are left, longest
+// first among equally rare ones, and returns how many it removed.
+func (m *Model) Cap(max int) int {
+	type ngram struct {
+		context, word string
+		count         float64
+	}
+	all := make([]ngram, 0, m.Size())
+	for context, next := range m.counts {
+		for word, c := range next {
+			all = append(all, ngram{context, word, c})
+		}
+	}
+	if len(all) <= max {
+		return 0
+	}
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if a.count != b.count {
+			return a.count < b.count
+		}
+		if la, lb := contextLen(a.context), contextLen(b.context); la != lb {
+			return la > lb
+		}
+		if a.context != b.context {
+			return a.context < b.context
+		}
+		return a.word < b.word
+	})
+	drop := map[[2]string]bool{}
+	for _, n := range all[:len(all)-max] {
+		drop[[2]string{n.context, n.word}] = true
+	}
+	return m.Prune(func(context, word string, _ float64) bool {
+		return drop[[2]string{context, word}]
+	})
+}
+
+// Stats describes the size of a model.
+type Stats struct {
+	NGrams []int   // n-grams of each order, unigrams first
+	Total  float64 // sum of the unigram counts
+	Bytes  int     // rough memory taken by the counts
+}
+
+// mapEntryBytes is a rough guess at the overhead of one map entry.
+const mapEntryBytes = 48
+
+// Stats returns the size of the model.
+func (m *Model) Stats() Stats {
+	st := Stats{NGrams: make([]int, m.order)}
+	for context, next := range m.counts {
+		if n := contextLen(context); n < len(st.NGrams) {
+			st.NGrams[n] += len(next)
+		}
+		st.Bytes += len(context) + 2*mapEntryBytes
+		for word := range next {
+			st.Bytes += len(word) + mapEntryBytes
+		}
+	}
+	for _, c := range m.counts[""] {
+		st.Total += c
+	}
+	return st
+}
+
+// contextLen returns the number of words in a context key.
+func contextLen(context string) int {
+	if context == "" {
+		return 0
+	}
+	return strings.Count(context, " ") + 1
+}
+
+// Unigrams returns how often each word has been seen. The map belongs to
+// the model and must not be modified.
+func (m *Model) Unigrams() map[string]float64 {
+	return m.counts[""]
+}
+
+// Following returns how often each word has followed the words of
+// context exactly, without backing off to shorter contexts. The map
+// belongs to the model and must not be modified.
+func (m *Model) Following(context ...string) map[string]float64 {
+	return m.counts[strings.Join(context, " ")]
+}
+
+// contexts returns the keys of the contexts to look word up in after
+// sentence, longest first, ending with the empty context.
+func (m *Model) contexts(sentence []string) []string {
+	words := append([]string{Start}, sentence...)
+	var keys []string
+	for n := min(m.order-1, len(words)); n > 0; n-- {
+		keys = append(keys, strings.Join(words[len(words)-n:], " "))
+	}
+	return append(keys, "")
+}
+
+// Score returns the stupid backoff score of word following sentence: its
+// relative frequency after the longest context it was seen in, times
+// backoff for every shorter context tried. It is 0 for unknown words.
+func (m *Model) Score(sentence []string, word string) float64 {
+	weight := 1.0
+	for _, context := range m.contexts(sentence) {
+		if c := m.counts[context][word]; c > 0 {
+			return weight * c / m.totals[context]
+		}
+		weight *= backoff
+	}
+	return 0
+}
+
+// Candidate is a predicted word and its score.
+type Candidate struct {
+	Word  string
+	Score float64
+}
+
+// Rank adds c to top, which holds at most k candidates ordered best
+// first, with ties broken alphabetically so rankings are deterministic.
+func Rank(top []Candidate, c Candidate, k int) []Candidate {
+	i := len(top)
+	for i > 0 && (c.Score > top[i-1].Score || c.Score == top[i-1].Score && c.Word < top[i-1].Word) {
+		i--
+	}
+	if i >= k {
+		return top
+	}
+	if len(top) < k {
+		top = append(top, Candidate{})
+	}
+	copy(top[i+1:], top[i:])
+	top[i] = c
+	return top
+}
+
+// Top returns the k words most likely to follow sentence, best first.
+func (m *Model) Top(sentence []string, k int) []Candidate {
+	if k <= 0 {
+		return nil
+	}
+	var top []Candidate
+	scored := map[string]bool{}
+	weight := 1.0
+	for _, context := range m.contexts(sentence) {
+		// Nothing seen only in shorter contexts can beat a full ranking.
+		if len(top) == k && top[k-1].Score >= weight {
+			break
+		}
+		for word := range m.counts[context] {
+			if scored[word] {
+				continue
+			}
+			scored[word] = true
+			top = Rank(top, Candidate{word, m.Score(sentence, word)}, k)
+		}
+		weight *= backoff
+	}
+	return top
+}
+
+// TopPrefix returns the k best words that start with prefix, which is
+// lowercase, among those seen after the words of sentence, best first,
+// ignoring their case and prefix itself. Words
+// only ever seen in the empty context are left out, as any word could
+// follow that.
+func (m *Model) TopPrefix(sentence []string, prefix string, k int) []Candidate {
+	if k <= 0 {
+		return nil
+	}
+	var top []Candidate
+	scored := map[string]bool{}
+	for _, context := range m.contexts(sentence) {
+		if context == "" {
+			break
+		}
+		for word := range m.counts[context] {
+			lower := strings.ToLower(word)
+			if scored[word] || lower == prefix || !strings.HasPrefix(lower, prefix) {
+				continue
+			}
+			scored[word] = true
+			top = Rank(top, Candidate{word, m.Score(sentence, word)}, k)
+		}
+	}
+	return top
+}
+
+// modelJSON is how a Model is stored on disk.
+type modelJSON struct {
+	Order  int                           `json:"order"`
+	Counts map[string]map[string]float64 `json:"counts"`
+}
+
+func (m *Model) MarshalJSON() ([]byte, error) {
+	return json.Marshal(modelJSON{Order: m.order, Counts: m.counts})
+}
+
+func (m *Model) UnmarshalJSON(data []byte) error {
+	var stored modelJSON
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	if stored.Order < 1 {
+		return fmt.Errorf("ngram: invalid order %d", stored.Order)
+	}
+	*m = *New(stored.Order)
+	for context, next := range stored.Counts {
+		for word, c := range next {
+			m.add(context, word, c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package ngram
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func testModel() *Model {
+	m := New(3)
+	m.Add([]string{"the", "cat", "sat"})
+	m.Add([]string{"the", "dog", "sat"})
+	m.Add([]string{"the", "dog", "ran"})
+	m.Add([]string{"a", "dog", "barked"})
+	return m
+}
+
+func TestScore(t *testing.T) {
+	m := testModel()
+	tests := []struct {
+		sentence []string
+		word     string
+		want     float64
+	}{
+		// After <s> the: cat once, dog twice
+		{[]string{"the"}, "dog", 2.0 / 3},
+		{[]string{"the", "dog"}, "sat", 1.0 / 2},
+		// Never after a dog, so backed off once to after dog
+		{[]string{"a", "dog"}, "sat", backoff * 1.0 / 3},
+		{[]string{"the", "dog"}, "barked", backoff * 1.0 / 3},
+		// Backed off twice to how often it was seen at all
+		{[]string{"the"}, "sat", backoff * backoff * 2.0 / 12},
+		{[]string{"unknown"}, "cat", backoff * backoff * 1.0 / 12},
+		{[]string{"the"}, "unknown", 0},
+	}
+	for _, tt := range tests {
+		if got := m.Score(tt.sentence, tt.word); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("Score(%v, %q) = %g, want %g", tt.sentence, tt.word, got, tt.want)
+		}
+	}
+}
+
+// TestScoreNegative checks that an n-gram whose count was taken back to
+// zero or below, as by undoing or purging, is backed off from.
+func TestScoreNegative(t *testing.T) {
+	m := testModel()
+	m.AddWeighted([]string{"the", "cat", "sat"}, -1)
+	if got, want := m.Score([]string{"the"}, "cat"), 0.0; got != want {
+		t.Errorf("Score of a sentence taken back = %g, want %g", got, want)
+	}
+	if got, want := m.Score([]string{"the"}, "dog"), 1.0; got != want {
+		t.Errorf("Score(the, dog) = %g, want %g once cat is taken back", got, want)
+	}
+	// Backed off twice, to dog seen twice among the 6 words left
+	m.AddWeighted([]string{"a", "dog", "barked"}, -1)
+	if got, want := m.Score([]string{"a"}, "dog"), backoff*backoff*2.0/6; math.Abs(got-want) > 1e-12 {
+		t.Errorf("Score(a, dog) = %g, want %g once a dog barked is taken back", got, want)
+	}
+}
+
+func TestTop(t *testing.T) {
+	m := testModel()
+	tests := []struct {
+		sentence []string
+		k        int
+		want     []Candidate
+	}{
+		{[]string{"the"}, 2, []Candidate{{"dog", 2.0 / 3}, {"cat", 1.0 / 3}}},
+		// Backing off fills the rest, ties alphabetically
+		{[]string{"the", "cat"}, 3, []Candidate{{"sat", 1}, {"dog", backoff * backoff * 3 / 12}, {"the", backoff * backoff * 3 / 12}}},
+		{nil, 2, []Candidate{{"the", 3.0 / 4}, {"a", 1.0 / 4}}},
+		{[]string{"the"}, 0, nil},
+	}
+	for _, tt := range tests {
+		got := m.Top(tt.sentence, tt.k)
+		if !sameCandidates(got, tt.want) {
+			t.Errorf("Top(%v, %d) = %v, want %v", tt.sentence, tt.k, got, tt.want)
+		}
+	}
+}
+
+func TestTopPrefix(t *testing.T) {
+	m := New(3)
+	m.Add([]string{"I", "like", "Dogs"})
+	m.Add([]string{"I", "like", "dots"})
+	m.Add([]string{"I", "like", "dots"})
+	m.Add([]string{"I", "like", "do"})
+	m.Add([]string{"we", "dig", "dogs"})
+	tests := []struct {
+		sentence []string
+		prefix   string
+		want     []Candidate
+	}{
+		// Case is ignored, and the prefix itself left out
+		{[]string{"I", "like"}, "do", []Candidate{{"dots", 2.0 / 4}, {"Dogs", 1.0 / 4}}},
+		// Seen after like, backing off from after I like
+		{[]string{"you", "like"}, "dot", []Candidate{{"dots", backoff * 2.0 / 4}}},
+		// Words seen only in the empty context aren't offered
+		{[]string{"they"}, "dog", nil},
+	}
+	for _, tt := range tests {
+		if got := m.TopPrefix(tt.sentence, tt.prefix, 3); !sameCandidates(got, tt.want) {
+			t.Errorf("TopPrefix(%v, %q) = %v, want %v", tt.sentence, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestCap(t *testing.T) {
+	m := New(2)
+	m.Add([]string{"a", "b"})
+	m.Add([]string{"a", "c"})
+	m.Add([]string{"a", "b"})
+	// Unigrams <s>→a:3, a→b:2, a→c:1, and b:2, c:1, a:3 in the empty context
+	if got := m.Size(); got != 6 {
+		t.Fatalf("Size() = %d, want 6", got)
+	}
+	if got := m.Cap(10); got != 0 {
+		t.Errorf("Cap(10) removed %d, want 0", got)
+	}
+	// Of the two seen once, the bigram goes first
+	if got := m.Cap(5); got != 1 {
+		t.Errorf("Cap(5) removed %d, want 1", got)
+	}
+	if _, ok := m.Following("a")["c"]; ok {
+		t.Error("Cap(5) kept the bigram a c, want it removed before the unigram c")
+	}
+	if got := m.Unigrams()["c"]; got != 1 {
+		t.Errorf("Cap(5) left c counted %g times, want 1", got)
+	}
+	if got := m.Cap(2); got != 3 {
+		t.Errorf("Cap(2) removed %d, want 3", got)
+	}
+	want := map[string]map[string]float64{"<s>": {"a": 3}, "": {"a": 3}}
+	if !reflect.DeepEqual(m.counts, want) {
+		t.Errorf("after Cap(2), counts = %v, want %v", m.counts, want)
+	}
+}
+
+// sameCandidates reports whether a and b are the same words in the same
+// order, with scores equal but for rounding.
+func sameCandidates(a, b []Candidate) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Word != b[i].Word || math.Abs(a[i].Score-b[i].Score) > 1e-12 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package ngram
+
+// Trie indexes words by prefix. Every node caches the best words below
+// it, so completing a prefix costs the same however large the
+// vocabulary grows.
+type Trie struct {
+	root *trieNode
+	k    int // completions cached per node
+}
+
+type trieNode struct {
+	word     string // the prefix leading to this node
+	children map[rune]*trieNode
+	count    float64     // times word itself was added
+	total    float64     // count of this node and every node below it
+	top      []Candidate // best words at or below this node, scored by count
+}
+
+// NewTrie returns an empty trie that completes prefixes with up to k
+// words.
+func NewTrie(k int) *Trie {
+	// One spare slot lets Complete skip the prefix itself.
+	return &Trie{root: &trieNode{}, k: k + 1}
+}
+
+// Add adds count to word, updating the cached completions of every
+// prefix of it.
+func (t *Trie) Add(word string, count float64) {
+	if word == "" {
+		return
+	}
+	path := []*trieNode{t.root}
+	n := t.root
+	for i, r := range word {
+		child := n.children[r]
+		if child == nil {
+			if n.children == nil {
+				n.children = map[rune]*trieNode{}
+			}
+			child = &trieNode{word: word[:i+len(string(r))]}
+			n.children[r] = child
+		}
+		n = child
+		path = append(path, n)
+	}
+	n.count += count
+	for i := len(path) - 1; i >= 0; i-- {
+		path[i].refresh(t.k)
+	}
+}
+
+// refresh recomputes the node's total and completions from its own count
+// and its children's, which are up to date.
+func (n *trieNode) refresh(k int) {
+	n.total = max(n.count, 0)
+	n.top = n.top[:0]
+	if n.count > 0 {
+		n.top = Rank(n.top, Candidate{n.word, n.count}, k)
+	}
+	for _, child := range n.children {
+		n.total += child.total
+		for _, c := range child.top {
+			n.top = Rank(n.top, c, k)
+		}
+	}
+}
+
+func (t *Trie) find(prefix string) *trieNode {
+	n := t.root
+	for _, r := range prefix {
+		if n = n.children[r]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// Count returns how many times word was added.
+func (t *Trie) Count(word string) float64 {
+	if n := t.find(word); n != nil {
+		return n.count
+	}
+	return 0
+}
+
+// Complete returns the most frequent words that extend prefix, best
+// first, not counting prefix itself.
+func (t *Trie) Complete(prefix string) []Candidate {
+	n := t.find(prefix)
+	if n == nil {
+		return nil
+	}
+	var top []Candidate
+	for _, c := range n.top {
+		if c.Word != prefix && len(top) < t.k-1 {
+			top = append(top, c)
+		}
+	}
+	return top
+}
+
+// Branch is one way of continuing a prefix: the next letter, the total
+// count of the words it leads to and the most frequent of them.
+type Branch struct {
+	Letter rune
+	Total  float64
+	Top    []Candidate
+}
+
+// Branches returns the letters that can follow prefix.
+func (t *Trie) Branches(prefix string) []Branch {
+	n := t.find(prefix)
+	if n == nil {
+		return nil
+	}
+	branches := make([]Branch, 0, len(n.children))
+	for r, child := range n.children {
+		if child.total > 0 {
+			branches = append(branches, Branch{r, child.total, child.top})
+		}
+	}
+	return branches
+}
+
+// Fuzzy returns the words that start with something within maxCost edits
+// of prefix, each scored by the cost of its closest prefix. Inserting or
+// deleting a letter costs 1 and substituting b for a costs substitute(a,
+// b). Only the cached completions of each matching prefix are returned.
+func (t *Trie) Fuzzy(prefix string, maxCost float64, substitute func(a, b rune) float64) []Candidate {
+	return t.fuzzy(prefix, false, maxCost, substitute)
+}
+
+// Near returns the words within maxCost edits of word, each scored by
+// its cost, with edits costed as by Fuzzy.
+func (t *Trie) Near(word string, maxCost float64, substitute func(a, b rune) float64) []Candidate {
+	return t.fuzzy(word, true, maxCost, substitute)
+}
+
+// fuzzy finds the words near query, or with whole unset, the completions
+// of the prefixes near it.
+func (t *Trie) fuzzy(query string, whole bool, maxCost float64, substitute func(a, b rune) float64) []Candidate {
+	s := fuzzySearch{
+		query:      []rune(query),
+		whole:      whole,
+		maxCost:    maxCost,
+		substitute: substitute,
+		costs:      map[string]float64{},
+	}
+	row := make([]float64, len(s.query)+1)
+	for j := range row {
+		row[j] = float64(j)
+	}
+	for r, child := range t.root.children {
+		s.visit(child, r, row)
+	}
+	matches := make([]Candidate, 0, len(s.costs))
+	for word, cost := range s.costs {
+		matches = append(matches, Candidate{word, cost})
+	}
+	return matches
+}
+
+// fuzzySearch is the state of a search by Fuzzy or Near.
+type fuzzySearch struct {
+	query      []rune
+	whole      bool
+	maxCost    float64
+	substitute func(a, b rune) float64
+	costs      map[string]float64 // lowest cost of each word found
+}
+
+// visit extends the edit distance row of the parent's prefix by the
+// letter r leading to n, recording n's word or completions if it is
+// close enough and descending while any of its descendants could be.
+func (s *fuzzySearch) visit(n *trieNode, r rune, parent []float64) {
+	row := make([]float64, len(parent))
+	row[0] = parent[0] + 1
+	best := row[0]
+	for j := 1; j < len(row); j++ {
+		sub := parent[j-1]
+		if s.query[j-1] != r {
+			sub += s.substitute(s.query[j-1], r)
+		}
+		row[j] = min(parent[j]+1, row[j-1]+1, sub)
+		best = min(best, row[j])
+	}
+	if cost := row[len(row)-1]; cost <= s.maxCost {
+		if !s.whole {
+			for _, c := range n.top {
+				s.record(c.Word, cost)
+			}
+		} else if n.count > 0 {
+			s.record(n.word, cost)
+		}
+	}
+	if best > s.maxCost {
+		return
+	}
+	for r, child := range n.children {
+		s.visit(child, r, row)
+	}
+}
+
+func (s *fuzzySearch) record(word string, cost float64) {
+	if old, ok := s.costs[word]; !ok || cost < old {
+		s.costs[word] = cost
+	}
+}
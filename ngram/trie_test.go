@@ -0,0 +1,213 @@
+package ngram
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTrieComplete(t *testing.T) {
+	tr := NewTrie(3)
+	for word, count := range map[string]float64{
+		"the": 10, "then": 4, "there": 4, "these": 2, "this": 6, "that": 1, "a": 3,
+	} {
+		tr.Add(word, count)
+	}
+	tests := []struct {
+		prefix string
+		want   []Candidate
+	}{
+		{"", []Candidate{{"the", 10}, {"this", 6}, {"then", 4}}},
+		// The prefix itself isn't a completion, and ties go alphabetically
+		{"the", []Candidate{{"then", 4}, {"there", 4}, {"these", 2}}},
+		{"thi", []Candidate{{"this", 6}}},
+		{"this", nil},
+		{"x", nil},
+	}
+	for _, tt := range tests {
+		if got := tr.Complete(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Complete(%q) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+	if got := tr.Count("the"); got != 10 {
+		t.Errorf("Count(\"the\") = %g, want 10", got)
+	}
+	if got := tr.Count("th"); got != 0 {
+		t.Errorf("Count(\"th\") = %g, want 0 for a prefix never added", got)
+	}
+}
+
+// TestTrieNegative checks that counts taken away, as by undoing or
+// purging, take words out of the completions and branches once they
+// reach zero, and that a count below zero doesn't hide other words.
+func TestTrieNegative(t *testing.T) {
+	tr := NewTrie(2)
+	tr.Add("cat", 3)
+	tr.Add("car", 2)
+	tr.Add("cab", 1)
+	tr.Add("dog", 1)
+
+	tr.Add("cat", -3)
+	if got, want := tr.Complete("ca"), []Candidate{{"car", 2}, {"cab", 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after taking cat away, Complete(\"ca\") = %v, want %v", got, want)
+	}
+	tr.Add("car", -5)
+	if got, want := tr.Complete("ca"), []Candidate{{"cab", 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after taking car below zero, Complete(\"ca\") = %v, want %v", got, want)
+	}
+	tr.Add("cab", -1)
+	if got := tr.Complete("c"); got != nil {
+		t.Errorf("after taking every c word away, Complete(\"c\") = %v, want none", got)
+	}
+	for _, b := range tr.Branches("") {
+		if b.Letter == 'c' {
+			t.Errorf("Branches(\"\") has c, whose words were all taken away: %+v", b)
+		}
+	}
+	if got, want := tr.Branches(""), []Branch{{'d', 1, []Candidate{{"dog", 1}}}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Branches(\"\") = %+v, want %+v", got, want)
+	}
+}
+
+// TestTrieCache checks the completions cached at every node against
+// ranking every word, after many updates of both signs.
+func TestTrieCache(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	tr := NewTrie(3)
+	counts := map[string]float64{}
+	letters := "abc"
+	for range 2000 {
+		word := make([]byte, 1+rng.IntN(4))
+		for i := range word {
+			word[i] = letters[rng.IntN(len(letters))]
+		}
+		// Whole counts keep sums exact, and make ties common
+		count := float64(rng.IntN(5) - 1)
+		tr.Add(string(word), count)
+		counts[string(word)] += count
+	}
+
+	var prefixes []string
+	for word := range counts {
+		for i := range len(word) + 1 {
+			prefixes = append(prefixes, word[:i])
+		}
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		var want []Candidate
+		for word, count := range counts {
+			if count > 0 && word != prefix && strings.HasPrefix(word, prefix) {
+				want = Rank(want, Candidate{word, count}, 3)
+			}
+		}
+		if got := tr.Complete(prefix); !reflect.DeepEqual(got, want) {
+			t.Errorf("Complete(%q) = %v, want %v", prefix, got, want)
+		}
+	}
+}
+
+// neighbourCost costs substituting letters next to each other in the
+// alphabet half as much as others.
+func neighbourCost(a, b rune) float64 {
+	if a-b == 1 || b-a == 1 {
+		return 0.5
+	}
+	return 1
+}
+
+func TestTrieNear(t *testing.T) {
+	tr := NewTrie(3)
+	for _, word := range []string{"this", "thin", "than", "that", "the", "then"} {
+		tr.Add(word, 1)
+	}
+	tests := []struct {
+		word    string
+		maxCost float64
+		want    []Candidate
+	}{
+		{"this", 0, []Candidate{{"this", 0}}},
+		// s is next to t
+		{"thit", 0.5, []Candidate{{"this", 0.5}}},
+		{"thit", 1, []Candidate{{"that", 1}, {"thin", 1}, {"this", 0.5}}},
+		// Two edits from the
+		{"hen", 1, []Candidate{{"then", 1}}},
+		{"thxs", 0.9, nil},
+	}
+	for _, tt := range tests {
+		got := tr.Near(tt.word, tt.maxCost, neighbourCost)
+		sortCandidates(got)
+		if len(got) == 0 {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Near(%q, %g) = %v, want %v", tt.word, tt.maxCost, got, tt.want)
+		}
+	}
+}
+
+func TestTrieFuzzy(t *testing.T) {
+	tr := NewTrie(2)
+	for word, count := range map[string]float64{"then": 3, "there": 2, "these": 1, "tin": 5, "go": 1} {
+		tr.Add(word, count)
+	}
+	tests := []struct {
+		prefix  string
+		maxCost float64
+		want    []Candidate
+	}{
+		// The cached completions of each close prefix, one more than
+		// Complete offers
+		{"the", 0, []Candidate{{"then", 0}, {"there", 0}, {"these", 0}}},
+		// g is next to h
+		{"tge", 0.5, []Candidate{{"then", 0.5}, {"there", 0.5}, {"these", 0.5}}},
+		// and i too, while go is two edits away
+		{"ti", 1, []Candidate{{"then", 0.5}, {"there", 0.5}, {"these", 0.5}, {"tin", 0}}},
+	}
+	for _, tt := range tests {
+		got := tr.Fuzzy(tt.prefix, tt.maxCost, neighbourCost)
+		sortCandidates(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Fuzzy(%q, %g) = %v, want %v", tt.prefix, tt.maxCost, got, tt.want)
+		}
+	}
+}
+
+// sortCandidates sorts candidates by word, as Fuzzy and Near return them
+// in no particular order.
+func sortCandidates(cs []Candidate) {
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Word < cs[j].Word })
+}
+
+// benchmarkWords returns n different made-up words with Zipf-like
+// counts, the same on every run.
+func benchmarkWords(n int) map[string]float64 {
+	rng := rand.New(rand.NewPCG(1, 2))
+	words := make(map[string]float64, n)
+	for len(words) < n {
+		word := make([]byte, 2+rng.IntN(9))
+		for i := range word {
+			word[i] = 'a' + byte(rng.IntN(26))
+		}
+		words[string(word)] = 1000 / float64(len(words)+1)
+	}
+	return words
+}
+
+func BenchmarkTrieComplete(b *testing.B) {
+	for _, size := range []int{1_000, 10_000, 100_000} {
+		t := NewTrie(3)
+		for word, count := range benchmarkWords(size) {
+			t.Add(word, count)
+		}
+		prefixes := []string{"", "t", "th", "qz", "abc"}
+		b.Run(fmt.Sprintf("words=%d", size), func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				t.Complete(prefixes[i%len(prefixes)])
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Output is where the ring keyboard sends keystrokes. Key names follow
+// robotgo's naming ("backspace", "enter", "up", "shift", ...) so every
+// backend understands the same vocabulary.
+type Output interface {
+	// KeyTap presses and releases a single named key.
+	KeyTap(key string) error
+	// TypeStr types a string of text.
+	TypeStr(s string) error
+	// KeyDown presses and holds a modifier key.
+	KeyDown(key string) error
+	// KeyUp releases a modifier held with KeyDown.
+	KeyUp(key string) error
+}
+
+// typeChecker is implemented by outputs that can only type some
+// characters.
+type typeChecker interface {
+	// CanType reports whether TypeStr can type s.
+	CanType(s string) bool
+}
+
+// checkLayout returns an error listing the ring entries of layout that
+// out can't type.
+func checkLayout(out Output, layout LayoutConfig) error {
+	c, ok := out.(typeChecker)
+	if !ok {
+		return nil
+	}
+	var bad []string
+	seen := map[string]bool{}
+	for _, set := range layout.Sets {
+		for _, rc := range set.Rings {
+			for _, entry := range rc.Entries {
+				if _, named := namedKeys[entry]; named || seen[entry] || c.CanType(entry) {
+					continue
+				}
+				seen[entry] = true
+				bad = append(bad, strconv.Quote(entry))
+			}
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("the layout has entries this output can't type: %s", strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// outputBackends are the outputs selectable with the -output flag.
+var outputBackends = map[string]func() (Output, error){
+	"robotgo": func() (Output, error) { return robotgoOutput{}, nil },
+	"log":     func() (Output, error) { return logOutput{}, nil },
+}
+
+// newOutput creates the output backend registered under name.
+func newOutput(name string) (Output, error) {
+	create, ok := outputBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output %q (available: %s)", name, strings.Join(outputNames(), ", "))
+	}
+	return create()
+}
+
+// outputNames returns the registered backend names in sorted order.
+func outputNames() []string {
+	names := make([]string, 0, len(outputBackends))
+	for name := range outputBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// logOutput logs every keystroke instead of sending it anywhere.
+type logOutput struct{}
+
+func (logOutput) KeyTap(key string) error {
+	log.Printf("output: tap %s", key)
+	return nil
+}
+
+func (logOutput) TypeStr(s string) error {
+	log.Printf("output: type %q", s)
+	return nil
+}
+
+func (logOutput) KeyDown(key string) error {
+	log.Printf("output: down %s", key)
+	return nil
+}
+
+func (logOutput) KeyUp(key string) error {
+	log.Printf("output: up %s", key)
+	return nil
+}
+
+// OutputEvent is a single call made on an Output.
+type OutputEvent struct {
+	Op  string // "tap", "type", "down" or "up"
+	Key string // key name, or the text for "type"
+}
+
+func (e OutputEvent) String() string {
+	if e.Op == "type" {
+		return fmt.Sprintf("type %q", e.Key)
+	}
+	return e.Op + " " + e.Key
+}
+
+// recordingOutput keeps every keystroke in memory, for tests and replays.
+type recordingOutput struct {
+	Events []OutputEvent
+}
+
+func (r *recordingOutput) KeyTap(key string) error {
+	r.Events = append(r.Events, OutputEvent{Op: "tap", Key: key})
+	return nil
+}
+
+func (r *recordingOutput) TypeStr(s string) error {
+	r.Events = append(r.Events, OutputEvent{Op: "type", Key: s})
+	return nil
+}
+
+func (r *recordingOutput) KeyDown(key string) error {
+	r.Events = append(r.Events, OutputEvent{Op: "down", Key: key})
+	return nil
+}
+
+func (r *recordingOutput) KeyUp(key string) error {
+	r.Events = append(r.Events, OutputEvent{Op: "up", Key: key})
+	return nil
+}
+
+// Text returns the text the recorded keystrokes would leave in an empty
+// editor: typed strings are appended, backspace removes the last character
+// and enter adds a newline. Other keys are ignored.
+func (r *recordingOutput) Text() string {
+	var text []rune
+	for _, e := range r.Events {
+		switch {
+		case e.Op == "type":
+			text = append(text, []rune(e.Key)...)
+		case e.Op == "tap" && e.Key == "backspace":
+			if len(text) > 0 {
+				text = text[:len(text)-1]
+			}
+		case e.Op == "tap" && e.Key == "enter":
+			text = append(text, '\n')
+		}
+	}
+	return string(text)
+}
+
+// tapKey sends a single key to the output, logging failures.
+func (g *Game) tapKey(key string) {
+	if err := g.output.KeyTap(key); err != nil {
+		log.Printf("Error sending key %s: %v", key, err)
+	}
+}
+
+// typeStr types text through the output, logging failures.
+func (g *Game) typeStr(s string) {
+	if err := g.output.TypeStr(s); err != nil {
+		log.Printf("Error typing %q: %v", s, err)
+	}
+}
+
+// backspace deletes the n characters before the cursor, and records that
+// in the typed text and the sentence being typed.
+func (g *Game) backspace(n int) {
+	if n <= 0 {
+		return
+	}
+	for range n {
+		g.tapKey("backspace")
+	}
+	deleted := strings.Repeat(rawTextBackspace, n)
+	if err := g.appendToRawText(deleted); err != nil {
+		log.Printf("Error saving backspace: %v", err)
+	}
+	g.trackTyped(deleted)
+}
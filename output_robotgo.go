@@ -0,0 +1,24 @@
+package main
+
+import "github.com/go-vgo/robotgo"
+
+// robotgoOutput sends keystrokes to the focused window through robotgo.
+// It needs an X11 (or macOS/Windows) session.
+type robotgoOutput struct{}
+
+func (robotgoOutput) KeyTap(key string) error {
+	return robotgo.KeyTap(key)
+}
+
+func (robotgoOutput) TypeStr(s string) error {
+	robotgo.TypeStr(s)
+	return nil
+}
+
+func (robotgoOutput) KeyDown(key string) error {
+	return robotgo.KeyDown(key)
+}
+
+func (robotgoOutput) KeyUp(key string) error {
+	return robotgo.KeyUp(key)
+}
@@ -0,0 +1,248 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+func init() {
+	outputBackends["uinput"] = func() (Output, error) { return openUinputOutput("/dev/uinput") }
+}
+
+// keyLeftShift is the evdev code of the left shift key.
+const keyLeftShift = 42
+
+// uinput ioctls, from <linux/uinput.h>.
+const (
+	uiDevCreate  = 0x5501
+	uiDevDestroy = 0x5502
+	uiSetEvBit   = 0x40045564
+	uiSetKeyBit  = 0x40045565
+)
+
+// uinputKeys maps robotgo key names to evdev key codes.
+var uinputKeys = map[string]uint16{
+	"esc": 1, "backspace": 14, "tab": 15, "enter": 28, "space": 57,
+	"shift": 42, "lshift": 42, "rshift": 54,
+	"ctrl": 29, "lctrl": 29, "rctrl": 97,
+	"alt": 56, "lalt": 56, "ralt": 100,
+	"cmd": 125, "lcmd": 125, "rcmd": 126,
+	"home": 102, "up": 103, "pageup": 104, "left": 105, "right": 106,
+	"end": 107, "down": 108, "pagedown": 109, "insert": 110, "delete": 111,
+	"f1": 59, "f2": 60, "f3": 61, "f4": 62, "f5": 63, "f6": 64,
+	"f7": 65, "f8": 66, "f9": 67, "f10": 68, "f11": 87, "f12": 88,
+}
+
+// uinputChar is the key (and whether shift is needed) that types a
+// character on a US layout.
+type uinputChar struct {
+	code  uint16
+	shift bool
+}
+
+var uinputChars = buildUinputChars()
+
+func buildUinputChars() map[rune]uinputChar {
+	chars := map[rune]uinputChar{
+		' ': {57, false}, '\n': {28, false}, '\t': {15, false},
+		'-': {12, false}, '=': {13, false}, '[': {26, false}, ']': {27, false},
+		';': {39, false}, '\'': {40, false}, '`': {41, false}, '\\': {43, false},
+		',': {51, false}, '.': {52, false}, '/': {53, false},
+		'!': {2, true}, '@': {3, true}, '#': {4, true}, '$': {5, true},
+		'%': {6, true}, '^': {7, true}, '&': {8, true}, '*': {9, true},
+		'(': {10, true}, ')': {11, true}, '_': {12, true}, '+': {13, true},
+		'{': {26, true}, '}': {27, true}, ':': {39, true}, '"': {40, true},
+		'~': {41, true}, '|': {43, true}, '<': {51, true}, '>': {52, true},
+		'?': {53, true},
+	}
+	for i, r := range "1234567890" {
+		chars[r] = uinputChar{uint16(2 + i), false}
+	}
+	letterCodes := []uint16{
+		30, 48, 46, 32, 18, 33, 34, 35, 23, 36, 37, 38, 50,
+		49, 24, 25, 16, 19, 31, 20, 22, 47, 17, 45, 21, 44,
+	}
+	for i, code := range letterCodes {
+		chars['a'+rune(i)] = uinputChar{code, false}
+		chars['A'+rune(i)] = uinputChar{code, true}
+	}
+	return chars
+}
+
+// uinputOutput types through a virtual keyboard created with /dev/uinput.
+// Unlike robotgo it works under Wayland and on the bare console, as long
+// as the user can write to /dev/uinput.
+//
+// A virtual keyboard sends key codes, not characters, so it can only type
+// what a US keyboard has, and only types the right characters when the
+// system's keyboard layout is US. Layouts with other characters, such as
+// ñ, ü or ß, are rejected; use -output robotgo for them.
+type uinputOutput struct {
+	w    io.Writer // receives one struct input_event per write
+	file *os.File  // the uinput device, nil when writing to a plain writer
+}
+
+// newUinputOutput returns an output that writes its event stream to w.
+// The stream is what the kernel expects after UI_DEV_CREATE, so w can be
+// a fake that captures events.
+func newUinputOutput(w io.Writer) *uinputOutput {
+	return &uinputOutput{w: w}
+}
+
+// openUinputOutput creates a virtual keyboard on the uinput device at path.
+func openUinputOutput(path string) (*uinputOutput, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := setupUinputDevice(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("uinput: %w", err)
+	}
+	// Give the compositor time to notice the new device before typing.
+	time.Sleep(200 * time.Millisecond)
+
+	out := newUinputOutput(f)
+	out.file = f
+	return out, nil
+}
+
+// setupUinputDevice enables every key we can send and creates the device.
+func setupUinputDevice(f *os.File) error {
+	if err := ioctl(f, uiSetEvBit, evKey); err != nil {
+		return err
+	}
+	codes := map[uint16]bool{}
+	for _, code := range uinputKeys {
+		codes[code] = true
+	}
+	for _, c := range uinputChars {
+		codes[c.code] = true
+	}
+	for code := range codes {
+		if err := ioctl(f, uiSetKeyBit, uintptr(code)); err != nil {
+			return err
+		}
+	}
+
+	// struct uinput_user_dev: name, input_id, ff_effects_max and the
+	// four absolute axis arrays, all unused for a keyboard.
+	var dev bytes.Buffer
+	name := make([]byte, 80)
+	copy(name, "control ring keyboard")
+	dev.Write(name)
+	binary.Write(&dev, binary.NativeEndian, [4]uint16{0x03, 0x1234, 0x5678, 1}) // BUS_USB
+	binary.Write(&dev, binary.NativeEndian, uint32(0))
+	dev.Write(make([]byte, 4*64*4))
+	if _, err := f.Write(dev.Bytes()); err != nil {
+		return err
+	}
+	return ioctl(f, uiDevCreate, 0)
+}
+
+// Close destroys the virtual keyboard.
+func (u *uinputOutput) Close() error {
+	if u.file == nil {
+		return nil
+	}
+	ioctl(u.file, uiDevDestroy, 0)
+	return u.file.Close()
+}
+
+func (u *uinputOutput) KeyTap(key string) error {
+	code, ok := uinputKeys[key]
+	if !ok {
+		return fmt.Errorf("uinput: unknown key %q", key)
+	}
+	return u.press(code, false)
+}
+
+// TypeStr types s character by character. Multi-character ring entries
+// such as "=>" or "&&" become one key press per character. Nothing is
+// typed if s contains a character without a key on the US layout, such
+// as a learned word with an accent.
+func (u *uinputOutput) TypeStr(s string) error {
+	keys := make([]uinputChar, 0, len(s))
+	for _, r := range s {
+		c, ok := uinputChars[r]
+		if !ok {
+			return fmt.Errorf("uinput: no key for %q on the US layout", r)
+		}
+		keys = append(keys, c)
+	}
+	for _, c := range keys {
+		if err := u.press(c.code, c.shift); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CanType reports whether every character of s has a key on the US
+// layout.
+func (u *uinputOutput) CanType(s string) bool {
+	for _, r := range s {
+		if _, ok := uinputChars[r]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (u *uinputOutput) KeyDown(key string) error {
+	code, ok := uinputKeys[key]
+	if !ok {
+		return fmt.Errorf("uinput: unknown key %q", key)
+	}
+	return u.emit(code, 1)
+}
+
+func (u *uinputOutput) KeyUp(key string) error {
+	code, ok := uinputKeys[key]
+	if !ok {
+		return fmt.Errorf("uinput: unknown key %q", key)
+	}
+	return u.emit(code, 0)
+}
+
+// press taps a key, holding shift around it when asked to.
+func (u *uinputOutput) press(code uint16, shift bool) error {
+	if shift {
+		if err := u.emit(keyLeftShift, 1); err != nil {
+			return err
+		}
+	}
+	if err := u.emit(code, 1); err != nil {
+		return err
+	}
+	if err := u.emit(code, 0); err != nil {
+		return err
+	}
+	if shift {
+		return u.emit(keyLeftShift, 0)
+	}
+	return nil
+}
+
+// emit writes a key event followed by a sync report. The kernel stamps
+// uinput events itself, so the time field is left zero.
+func (u *uinputOutput) emit(code uint16, value int32) error {
+	if err := u.write(inputEvent{Type: evKey, Code: code, Value: value}); err != nil {
+		return err
+	}
+	return u.write(inputEvent{Type: evSyn, Code: synReport})
+}
+
+func (u *uinputOutput) write(ev inputEvent) error {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.NativeEndian, ev)
+	_, err := u.w.Write(buf.Bytes())
+	return err
+}
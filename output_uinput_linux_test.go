@@ -0,0 +1,93 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// keyEvents decodes the key events of a uinput event stream, as
+// "+code" for a press and "-code" for a release, checking that each is
+// followed by a sync report.
+func keyEvents(t *testing.T, stream []byte) []string {
+	t.Helper()
+	r := bytes.NewReader(stream)
+	var keys []string
+	for r.Len() > 0 {
+		var ev, syn inputEvent
+		if err := binary.Read(r, binary.NativeEndian, &ev); err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		if err := binary.Read(r, binary.NativeEndian, &syn); err != nil {
+			t.Fatalf("reading sync after %+v: %v", ev, err)
+		}
+		if ev.Type != evKey || syn.Type != evSyn || syn.Code != synReport {
+			t.Fatalf("got %+v then %+v, want a key event then a sync report", ev, syn)
+		}
+		sign := "-"
+		if ev.Value == 1 {
+			sign = "+"
+		}
+		keys = append(keys, fmt.Sprintf("%s%d", sign, ev.Code))
+	}
+	return keys
+}
+
+func TestUinputOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(u *uinputOutput) error
+		want []string
+	}{
+		// "=" is unshifted, ">" is shift+"."
+		{"type =>", func(u *uinputOutput) error { return u.TypeStr("=>") }, []string{"+13", "-13", "+42", "+52", "-52", "-42"}},
+		{"type A", func(u *uinputOutput) error { return u.TypeStr("A") }, []string{"+42", "+30", "-30", "-42"}},
+		{"tap enter", func(u *uinputOutput) error { return u.KeyTap("enter") }, []string{"+28", "-28"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stream bytes.Buffer
+			if err := tt.send(newUinputOutput(&stream)); err != nil {
+				t.Fatal(err)
+			}
+			if got := keyEvents(t, stream.Bytes()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got keys %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUinputOutputRejectsUntypable(t *testing.T) {
+	var stream bytes.Buffer
+	if err := newUinputOutput(&stream).TypeStr("añb"); err == nil {
+		t.Error("typing ñ succeeded, want an error")
+	}
+	if stream.Len() != 0 {
+		t.Errorf("wrote %d bytes, want nothing typed when part of the text can't be", stream.Len())
+	}
+}
+
+func TestUinputCheckLayout(t *testing.T) {
+	out := newUinputOutput(&bytes.Buffer{})
+	if err := checkLayout(out, defaultConfig().Layout); err != nil {
+		t.Errorf("default layout: %v", err)
+	}
+
+	config := defaultConfig()
+	rc := &config.Layout.Sets[0].Rings[1]
+	rc.Entries = append(rc.Entries, "Ñ", "ü", "ß", "Ñ")
+	err := checkLayout(out, config.Layout)
+	if err == nil {
+		t.Fatal("layout with ñ, ü and ß accepted, want an error")
+	}
+	if want := `the layout has entries this output can't type: "Ñ", "ü", "ß"`; err.Error() != want {
+		t.Errorf("got error %q, want %q", err, want)
+	}
+	if err := checkLayout(&recordingOutput{}, config.Layout); err != nil {
+		t.Errorf("output that types anything: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"image/color"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-vgo/robotgo"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// windowCheckInterval is how often the focused window is checked against
+// the deny list, in the background.
+const windowCheckInterval = 250 * time.Millisecond
+
+// windowMaxAge is how old the last check can be for a button press to go
+// by it. Past that, as when checks in the background are held up, the
+// press waits for a check of its own.
+const windowMaxAge = time.Second
+
+// windowTitle returns the title of the focused window.
+var windowTitle = func() string { return robotgo.GetTitle() }
+
+// windowClass returns the class of the focused window, where the
+// platform can tell.
+var windowClass func() string
+
+// windowSupport returns why the focused window can't be told, where the
+// platform knows it sometimes can't.
+var windowSupport func() error
+
+// learning reports whether typing is recorded and learned from: not
+// while incognito or while a denied window had focus as the frame was
+// handled.
+func (g *Game) learning() bool {
+	return !g.incognito && !g.denied
+}
+
+// updateLearning starts a new sentence when learning pauses or resumes,
+// so that no sentence mixes what was typed while paused with what was
+// typed while not, and neither is learned with the other.
+func (g *Game) updateLearning() {
+	if paused := !g.learning(); paused != g.paused {
+		g.paused = paused
+		g.newSentence()
+	}
+}
+
+// pauseLearning pauses learning as updateLearning does, for a replay
+// that skips the frames a recording left out while learning was paused.
+func (g *Game) pauseLearning() {
+	if !g.paused {
+		g.paused = true
+		g.newSentence()
+	}
+}
+
+// newSentence forgets the sentence being typed and what the next press
+// could do to it.
+func (g *Game) newSentence() {
+	g.sentence = tokenizer{}
+	g.lastCorrection = nil
+	g.predictionSpaced = false
+	g.updatePrediction()
+}
+
+// logTyped logs a message that shows what was typed, unless learning is
+// paused: what isn't recorded mustn't end up in the log either.
+func (g *Game) logTyped(format string, args ...any) {
+	if g.learning() {
+		log.Printf(format, args...)
+	}
+}
+
+// drawPrivacy shows when typing isn't being recorded, and why.
+func (g *Game) drawPrivacy(screen *ebiten.Image) {
+	var label string
+	switch {
+	case g.incognito:
+		label = "incognito"
+	case g.denied:
+		label = "not recording"
+	default:
+		return
+	}
+	ebitenutil.DrawCircle(screen, 16, 16, 6, g.applyOpacity(color.RGBA{255, 60, 60, 255}))
+	bounds := text.BoundString(g.font, label)
+	text.Draw(screen, label, g.font, 28, 16+bounds.Dy()/2, g.applyOpacity(color.RGBA{255, 60, 60, 255}))
+}
+
+// windowWatcher checks in the background whether the focused window is
+// one where typing must not be recorded. Checking runs other programs,
+// so the game only waits for a check when the last one is stale.
+type windowWatcher struct {
+	deny    []string
+	denied  atomic.Bool
+	checked atomic.Int64 // when the last check began, in Unix nanoseconds
+	mu      sync.Mutex   // one check at a time
+}
+
+// newWindowWatcher starts watching the focused window. It returns nil,
+// which never denies, if deny is empty or the focused window can't be
+// told, as on Wayland.
+func newWindowWatcher(deny []string) *windowWatcher {
+	if len(deny) == 0 {
+		return nil
+	}
+	if windowSupport != nil {
+		if err := windowSupport(); err != nil {
+			log.Printf("privacy.deny_windows is ignored, %v; use incognito instead", err)
+			return nil
+		}
+	}
+	w := &windowWatcher{}
+	for _, pattern := range deny {
+		w.deny = append(w.deny, strings.ToLower(pattern))
+	}
+	go func() {
+		for {
+			w.check(0)
+			time.Sleep(windowCheckInterval)
+		}
+	}()
+	return w
+}
+
+// Denied reports whether the focused window is on the deny list.
+func (w *windowWatcher) Denied() bool {
+	return w != nil && w.denied.Load()
+}
+
+// check looks at the focused window now, unless the last check began
+// less than maxAge ago. It does nothing on a nil watcher, or one that
+// only tells what a recording says.
+func (w *windowWatcher) check(maxAge time.Duration) {
+	if w == nil || len(w.deny) == 0 || w.fresh(maxAge) {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// A check may have finished while this one waited
+	if w.fresh(maxAge) {
+		return
+	}
+	start := time.Now()
+	window := strings.ToLower(windowTitle())
+	if windowClass != nil {
+		window += "\n" + strings.ToLower(windowClass())
+	}
+	denied := false
+	for _, pattern := range w.deny {
+		if strings.Contains(window, pattern) {
+			denied = true
+			break
+		}
+	}
+	if w.denied.Swap(denied) != denied {
+		log.Printf("Recording paused for the focused window: %v", denied)
+	}
+	w.checked.Store(start.UnixNano())
+}
+
+// fresh reports whether the last check began less than maxAge ago.
+func (w *windowWatcher) fresh(maxAge time.Duration) bool {
+	return time.Since(time.Unix(0, w.checked.Load())) < maxAge
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncognitoSentence(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	g := &Game{output: &recordingOutput{}, config: defaultConfig()}
+	toggle := InputFrame{}.Hold(ButtonSelect).Press(ButtonStart)
+	var frames []InputFrame
+	frames = append(frames, keyFrames("good ")...)
+	frames = append(frames, toggle)
+	frames = append(frames, keyFrames("secret words ")...)
+	frames = append(frames, toggle)
+	frames = append(frames, keyFrames("good day\n")...)
+	for i, f := range frames {
+		f.Time = scriptStart.Add(time.Duration(i) * time.Second)
+		g.step(f)
+	}
+
+	if g.incognito {
+		t.Fatal("still incognito after toggling twice")
+	}
+	if strings.Contains(logged.String(), "secret") {
+		t.Errorf("text typed while incognito was logged:\n%s", logged.String())
+	}
+	unigrams := g.corpus.model.Unigrams()
+	for _, word := range []string{"secret", "words"} {
+		if unigrams[word] != 0 {
+			t.Errorf("learned %q, typed while incognito", word)
+		}
+	}
+	// Only what was typed after incognito ended makes the sentence
+	if got := g.corpus.model.Following("good")["day"]; got != 1 {
+		t.Errorf("learned \"good day\" %g times, want 1", got)
+	}
+	if got := g.corpus.model.Following(); len(got) != 2 {
+		t.Errorf("learned the words %v, want only good and day", got)
+	}
+}
+
+// TestWindowCheckFresh checks that a press only waits for the focused
+// window to be checked when the last check is stale.
+func TestWindowCheckFresh(t *testing.T) {
+	title := "Editor"
+	checks := 0
+	defer func(f func() string) { windowTitle = f }(windowTitle)
+	defer func(f func() string) { windowClass = f }(windowClass)
+	windowTitle = func() string {
+		checks++
+		return title
+	}
+	windowClass = nil
+
+	w := &windowWatcher{deny: []string{"password"}}
+	w.check(0)
+	if checks != 1 || w.Denied() {
+		t.Fatalf("first check: checked %d times, denied %v; want 1, false", checks, w.Denied())
+	}
+	title = "Password Manager"
+	w.check(windowMaxAge)
+	if checks != 1 || w.Denied() {
+		t.Errorf("press after a fresh check: checked %d times, denied %v; want 1, false", checks, w.Denied())
+	}
+	w.checked.Store(time.Now().Add(-2 * windowMaxAge).UnixNano())
+	w.check(windowMaxAge)
+	if checks != 2 || !w.Denied() {
+		t.Errorf("press after a stale check: checked %d times, denied %v; want 2, true", checks, w.Denied())
+	}
+}
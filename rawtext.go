@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+// The typed text file is the text as typed, with a mark recording the
+// time before text typed at least rawTextStampInterval after the last
+// mark. A mark is rawTextMark, an RFC 3339 time and a newline. Every
+// character deleted, by backspace or by replacing a word as with
+// autocorrect, is recorded as a rawTextBackspace after it. The ring can't
+// type either, so they never clash with text. Text from before marks
+// were added comes first and has no time.
+const (
+	rawTextMark          = "\x1e"
+	rawTextBackspace     = "\b"
+	rawTextStampInterval = time.Minute
+)
+
+// rawTextChunk is text typed from Time until the next mark.
+type rawTextChunk struct {
+	Time time.Time // zero for text from before marks were added
+	Text string
+}
+
+// parseRawTextChunks splits the typed text file into chunks at each mark.
+// A mark with a time that doesn't parse is kept as text.
+func parseRawTextChunks(data []byte) []rawTextChunk {
+	var chunks []rawTextChunk
+	var current rawTextChunk
+	var text bytes.Buffer
+	for len(data) > 0 {
+		i := bytes.Index(data, []byte(rawTextMark))
+		if i < 0 {
+			text.Write(data)
+			break
+		}
+		text.Write(data[:i])
+		rest := data[i+len(rawTextMark):]
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			text.Write(data[i:])
+			break
+		}
+		t, err := time.Parse(time.RFC3339, string(rest[:end]))
+		if err != nil {
+			text.Write(data[i : i+len(rawTextMark)])
+			data = rest
+			continue
+		}
+		if text.Len() > 0 {
+			current.Text = text.String()
+			chunks = append(chunks, current)
+			text.Reset()
+		}
+		current = rawTextChunk{Time: t}
+		data = rest[end+1:]
+	}
+	if text.Len() > 0 {
+		current.Text = text.String()
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// formatRawTextChunks joins chunks back into the typed text file format.
+func formatRawTextChunks(chunks []rawTextChunk) []byte {
+	var buf bytes.Buffer
+	for _, c := range chunks {
+		if !c.Time.IsZero() {
+			buf.WriteString(rawTextMark + c.Time.UTC().Format(time.RFC3339) + "\n")
+		}
+		buf.WriteString(c.Text)
+	}
+	return buf.Bytes()
+}
+
+// rawTextKeys returns the text of chunks without their times, as typed,
+// backspaces and all, for the tokenizer.
+func rawTextKeys(chunks []rawTextChunk) string {
+	var text strings.Builder
+	for _, c := range chunks {
+		text.WriteString(c.Text)
+	}
+	return text.String()
+}
+
+// rawTextString returns the text of chunks without their times, with
+// the characters deleted by each backspace removed.
+func rawTextString(chunks []rawTextChunk) string {
+	var text []rune
+	for _, c := range chunks {
+		for _, r := range c.Text {
+			if string(r) != rawTextBackspace {
+				text = append(text, r)
+			} else if len(text) > 0 {
+				text = text[:len(text)-1]
+			}
+		}
+	}
+	return string(text)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Recordings start with recordMagic, then the uvarint length and JSON of
+// the config the keyboard ran with. Each frame that follows is:
+//
+//	uvarint  nanoseconds since the previous frame
+//	byte     flags: bits 0-3 set for each stick axis that changed
+//	         (LX, LY, RX, RY), bit 4 if Held changed, bit 5 if any
+//	         button was pressed, bit 6 if frames were left out before
+//	         this one, bit 7 if the focused window was denied
+//	8 bytes  float64 bits of each changed axis, little endian
+//	uvarint  Held, if changed
+//	uvarint  Pressed, if any
+//
+// Idle frames take two or three bytes, and axes are stored exactly so a
+// replay crosses the same ring boundaries as the original session.
+// Frames are written as they come, so a recording survives the program
+// being killed, losing at most the frame being written.
+//
+// What is typed while learning is paused isn't recorded either: frames
+// handled then are left out, but for presses of the buttons that change
+// what later frames do, written without the stick or other buttons. A
+// replay pauses learning where frames were left out, and sees the
+// focused window denied where it was, so it types what was typed.
+const recordMagic = "CTRLREC2"
+
+// recordMagicV1 starts recordings made before the config was stored,
+// which replay with the built-in one.
+const recordMagicV1 = "CTRLREC1"
+
+const (
+	recordHeldChanged = 1 << 4
+	recordPressed     = 1 << 5
+	recordGap         = 1 << 6
+	recordDenied      = 1 << 7
+)
+
+// inputRecorder wraps an InputSource and writes the frames the game
+// handles to a file, as the game records them.
+type inputRecorder struct {
+	src  InputSource
+	file *os.File
+	last InputFrame
+	n    int
+	gap  bool // frames were left out since the last one written
+}
+
+// newInputRecorder starts a recording of src, made with config, at path.
+// Like the rest of what the user types, it is only readable by the user.
+func newInputRecorder(src InputSource, path string, config Config) (*inputRecorder, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(recordMagic), binary.AppendUvarint(nil, uint64(len(data)))...)
+	if _, err := file.Write(append(header, data...)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &inputRecorder{src: src, file: file}, nil
+}
+
+func (r *inputRecorder) Poll() (InputFrame, error) {
+	return r.src.Poll()
+}
+
+// recordFrame adds a frame just handled to the input recording, if there
+// is one. Of a frame handled while learning was paused only presses of
+// the buttons that toggle incognito or cycle the set are kept.
+func (g *Game) recordFrame(f InputFrame) error {
+	rec, ok := g.input.(*inputRecorder)
+	if !ok {
+		return nil
+	}
+	if g.framePaused {
+		keep := Buttons(0).With(ButtonSelect).With(ButtonStart)
+		if g.config.Layout.SetSwitch == "cycle" {
+			keep = keep.With(g.config.Layout.cycleButton)
+		}
+		if f.Pressed&keep == 0 {
+			rec.gap = true
+			return nil
+		}
+		f = InputFrame{
+			Time:    f.Time,
+			LeftX:   rec.last.LeftX,
+			LeftY:   rec.last.LeftY,
+			RightX:  rec.last.RightX,
+			RightY:  rec.last.RightY,
+			Held:    f.Held & keep,
+			Pressed: f.Pressed & keep,
+		}
+	}
+	if err := rec.write(f, g.denied); err != nil {
+		return fmt.Errorf("recording input: %w", err)
+	}
+	return nil
+}
+
+func (r *inputRecorder) write(f InputFrame, denied bool) error {
+	var buf []byte
+	if r.n > 0 {
+		buf = binary.AppendUvarint(buf, uint64(f.Time.Sub(r.last.Time)))
+	} else {
+		buf = binary.AppendUvarint(buf, 0)
+	}
+
+	axes := [4]float64{f.LeftX, f.LeftY, f.RightX, f.RightY}
+	lastAxes := [4]float64{r.last.LeftX, r.last.LeftY, r.last.RightX, r.last.RightY}
+	var flags byte
+	for i := range axes {
+		if axes[i] != lastAxes[i] {
+			flags |= 1 << i
+		}
+	}
+	if f.Held != r.last.Held {
+		flags |= recordHeldChanged
+	}
+	if f.Pressed != 0 {
+		flags |= recordPressed
+	}
+	if r.gap {
+		flags |= recordGap
+	}
+	if denied {
+		flags |= recordDenied
+	}
+	buf = append(buf, flags)
+	for i := range axes {
+		if flags&(1<<i) != 0 {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(axes[i]))
+		}
+	}
+	if flags&recordHeldChanged != 0 {
+		buf = binary.AppendUvarint(buf, uint64(f.Held))
+	}
+	if flags&recordPressed != 0 {
+		buf = binary.AppendUvarint(buf, uint64(f.Pressed))
+	}
+
+	r.last = f
+	r.n++
+	r.gap = false
+	_, err := r.file.Write(buf)
+	return err
+}
+
+// Close ends the recording.
+func (r *inputRecorder) Close() error {
+	return r.file.Close()
+}
+
+// replayInput plays back a recording made by inputRecorder. Frame times
+// start at the same fixed instant as scriptedInput, keeping the original
+// gaps between frames.
+type replayInput struct {
+	r      *bufio.Reader
+	last   InputFrame
+	config Config // what the keyboard ran with
+
+	// What the recording says of the frame last delivered: whether
+	// frames were left out before it, and whether the focused window
+	// was denied, which window reports.
+	gap    bool
+	window *windowWatcher
+}
+
+func openReplayInput(path string) (*replayInput, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newReplayInput(bufio.NewReader(bytes.NewReader(data)))
+}
+
+func newReplayInput(r *bufio.Reader) (*replayInput, error) {
+	magic := make([]byte, len(recordMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, errors.New("not an input recording")
+	}
+	p := &replayInput{
+		r:      r,
+		last:   InputFrame{Time: scriptStart},
+		config: defaultConfig(),
+		window: &windowWatcher{},
+	}
+	switch string(magic) {
+	case recordMagicV1:
+		return p, nil
+	case recordMagic:
+	default:
+		return nil, errors.New("not an input recording")
+	}
+
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, truncated(err)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, truncated(err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("reading recording config: %w", err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("recording config: %w", err)
+	}
+	p.config = config
+	return p, nil
+}
+
+func (p *replayInput) Poll() (InputFrame, error) {
+	delta, err := binary.ReadUvarint(p.r)
+	if err == io.EOF {
+		return InputFrame{}, io.EOF
+	}
+	if err != nil {
+		return InputFrame{}, fmt.Errorf("reading recording: %w", err)
+	}
+	flags, err := p.r.ReadByte()
+	if err != nil {
+		return InputFrame{}, truncated(err)
+	}
+
+	f := p.last
+	f.Time = f.Time.Add(time.Duration(delta))
+	f.Pressed = 0
+	axes := [4]*float64{&f.LeftX, &f.LeftY, &f.RightX, &f.RightY}
+	for i, axis := range axes {
+		if flags&(1<<i) == 0 {
+			continue
+		}
+		var bits [8]byte
+		if _, err := io.ReadFull(p.r, bits[:]); err != nil {
+			return InputFrame{}, truncated(err)
+		}
+		*axis = math.Float64frombits(binary.LittleEndian.Uint64(bits[:]))
+	}
+	if flags&recordHeldChanged != 0 {
+		held, err := binary.ReadUvarint(p.r)
+		if err != nil {
+			return InputFrame{}, truncated(err)
+		}
+		f.Held = Buttons(held)
+	}
+	if flags&recordPressed != 0 {
+		pressed, err := binary.ReadUvarint(p.r)
+		if err != nil {
+			return InputFrame{}, truncated(err)
+		}
+		f.Pressed = Buttons(pressed)
+	}
+	p.last = f
+	p.gap = flags&recordGap != 0
+	p.window.denied.Store(flags&recordDenied != 0)
+	return f, nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("reading recording: %w", err)
+}
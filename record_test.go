@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordSession handles frames in a game that records them to path, with
+// the focused window denied while handling those at the indexes in
+// denied. It returns what the game typed, and how many events it had
+// typed before each frame.
+func recordSession(t *testing.T, path string, config Config, frames []InputFrame, denied map[int]bool) (*recordingOutput, []int) {
+	t.Helper()
+	rec, err := newInputRecorder(newScriptedInput(frames...), path, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &recordingOutput{}
+	g := &Game{input: rec, output: out, config: config, window: &windowWatcher{}}
+	var typed []int
+	for i := 0; ; i++ {
+		f, err := rec.Poll()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		typed = append(typed, len(out.Events))
+		g.window.denied.Store(denied[i])
+		g.step(f)
+		if err := g.recordFrame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out, typed
+}
+
+func TestRecordReplay(t *testing.T) {
+	config := defaultConfig()
+	off := false
+	config.Typing.AutoShift = &off
+
+	path := filepath.Join(t.TempDir(), "session.rec")
+	// Presses of A are debounced, so wait a while between them
+	d := Stick(45, 1)
+	frames := []InputFrame{d, d.Press(ButtonA), InputFrame{}.Press(ButtonX)}
+	for range 15 {
+		frames = append(frames, d)
+	}
+	frames = append(frames, d.Press(ButtonA))
+	recordSession(t, path, config, frames, nil)
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("recording mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	input, err := openReplayInput(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.config.Typing.autoShift() {
+		t.Error("replay uses auto-shift, want the recording's config with it off")
+	}
+	out, err := replay(input, input.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Text(); got != "d d" {
+		t.Errorf("replayed %q, want %q", got, "d d")
+	}
+
+	// A recording cut off in its last frame replays the frames before it
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)-1], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if input, err = openReplayInput(path); err != nil {
+		t.Fatal(err)
+	}
+	cut, err := replay(input, input.config)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("replaying a cut recording: got error %v, want unexpected EOF", err)
+	}
+	if want := out.Events[:len(out.Events)-1]; !reflect.DeepEqual(cut.Events, want) {
+		t.Errorf("replaying a cut recording: got %v, want %v", cut.Events, want)
+	}
+}
+
+// TestRecordReplayPaused checks that a replay types what was typed
+// outside pauses of learning, incognito or for a denied window, with
+// nothing typed during them in the recording.
+func TestRecordReplayPaused(t *testing.T) {
+	toggle := InputFrame{}.Hold(ButtonSelect).Press(ButtonStart)
+	var frames []InputFrame
+	add := func(fs ...InputFrame) (from, to int) {
+		from = len(frames)
+		frames = append(frames, fs...)
+		return from, len(frames)
+	}
+	add(keyFrames("good ")...)
+	incognitoFrom, incognitoTo := add(append(append([]InputFrame{toggle}, keyFrames("secret ")...), toggle)...)
+	add(keyFrames("good")...)
+	deniedFrom, deniedTo := add(keyFrames("x password ")...)
+	// R2 accepts a prediction for the sentence typed so far, backspace
+	// deletes from it
+	add(InputFrame{}.Press(ButtonR2))
+	add(keyFrames("\b\b")...)
+	for i := range frames {
+		frames[i].Time = scriptStart.Add(time.Duration(i) * time.Second)
+	}
+	denied := map[int]bool{}
+	for i := deniedFrom; i < deniedTo; i++ {
+		denied[i] = true
+	}
+
+	path := filepath.Join(t.TempDir(), "session.rec")
+	live, typed := recordSession(t, path, defaultConfig(), frames, denied)
+	// The toggle that ends incognito types nothing, so what was typed
+	// while paused is what the live game typed from the first frame of
+	// each pause to the frame after it
+	var want []OutputEvent
+	want = append(want, live.Events[:typed[incognitoFrom]]...)
+	want = append(want, live.Events[typed[incognitoTo]:typed[deniedFrom]]...)
+	want = append(want, live.Events[typed[deniedTo]:]...)
+
+	input, err := openReplayInput(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := replay(input, input.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.Events, want) {
+		t.Errorf("replayed %q, want %q", out.Events, want)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := Stick(float64('s'-'a')*360/26, 1)
+	if bytes.Contains(data, binary.LittleEndian.AppendUint64(nil, math.Float64bits(secret.LeftX))) {
+		t.Error("the recording has the stick where s is, typed while incognito")
+	}
+}
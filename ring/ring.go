@@ -0,0 +1,121 @@
+// Package ring maps gamepad stick positions to entries on the concentric
+// rings of the keyboard, and ring entries to positions on screen. Update
+// and Draw both go through it, so the entry drawn under the stick is the
+// one that gets typed.
+package ring
+
+import "math"
+
+// Deadzone is the stick magnitude below which nothing is selected.
+const Deadzone = 0.1
+
+// Layout describes concentric rings, innermost first. Entry 0 of every
+// ring sits at 12 o'clock and the rest follow clockwise.
+type Layout struct {
+	Sizes []int     // number of entries on each ring
+	Radii []float64 // drawing radius of each ring, in pixels
+	// Bands holds, for each ring after the first, the stick magnitude
+	// at which it starts. Must be increasing and within (Deadzone, 1].
+	Bands []float64
+	// Weights optionally gives, per ring, the relative angular width of
+	// each entry's segment. A ring without weights, or whose weights
+	// don't match its size, is evenly spaced.
+	Weights [][]float64
+}
+
+// Angle returns the direction of a stick position in radians, clockwise
+// from straight up, in [0, 2π). Stick y points down, as on screen.
+func Angle(x, y float64) float64 {
+	angle := math.Atan2(x, -y)
+	if angle < 0 {
+		angle += 2 * math.Pi
+	}
+	return angle
+}
+
+// Index returns which of n entries is closest to angle. Entry i is drawn
+// at i*2π/n and owns the segment centred on it.
+func Index(angle float64, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	segment := 2 * math.Pi / float64(n)
+	i := int(math.Floor(angle/segment + 0.5))
+	return (i%n + n) % n
+}
+
+// Ring returns which ring a stick magnitude selects. ok is false inside
+// the deadzone.
+func (l Layout) Ring(magnitude float64) (ring int, ok bool) {
+	if magnitude <= Deadzone || len(l.Sizes) == 0 {
+		return 0, false
+	}
+	for ring < len(l.Sizes)-1 && ring < len(l.Bands) && magnitude >= l.Bands[ring] {
+		ring++
+	}
+	return ring, true
+}
+
+// Select maps a stick position to a ring and an entry on it. ok is false
+// inside the deadzone or when the selected ring is empty.
+func (l Layout) Select(x, y float64) (ring, index int, ok bool) {
+	ring, ok = l.Ring(math.Hypot(x, y))
+	if !ok || l.Sizes[ring] == 0 {
+		return 0, 0, false
+	}
+	return ring, l.Index(ring, Angle(x, y)), true
+}
+
+// Index returns which entry of ring owns angle. Like the package-level
+// Index, each entry's segment is centred on where it is drawn, but
+// segments follow the ring's weights.
+func (l Layout) Index(ring int, angle float64) int {
+	weights := l.weights(ring)
+	if weights == nil {
+		return Index(angle, l.Sizes[ring])
+	}
+	total := sum(weights)
+	// Measure from the start of entry 0's segment rather than its centre.
+	a := math.Mod(angle/(2*math.Pi)*total+weights[0]/2, total)
+	for i, w := range weights {
+		if a < w {
+			return i
+		}
+		a -= w
+	}
+	return len(weights) - 1
+}
+
+// Position returns where entry index of ring is drawn, relative to the
+// centre of the keyboard, with y pointing down.
+func (l Layout) Position(ring, index int) (x, y float64) {
+	angle := float64(index) * 2 * math.Pi / float64(l.Sizes[ring])
+	if weights := l.weights(ring); weights != nil {
+		// The centre of the entry's segment, with entry 0 centred at 0.
+		centre := sum(weights[:index]) + weights[index]/2 - weights[0]/2
+		angle = centre / sum(weights) * 2 * math.Pi
+	}
+	r := l.Radii[ring]
+	return r * math.Sin(angle), -r * math.Cos(angle)
+}
+
+// weights returns the usable weights of ring, or nil to space it evenly.
+func (l Layout) weights(ring int) []float64 {
+	if ring >= len(l.Weights) || len(l.Weights[ring]) != l.Sizes[ring] {
+		return nil
+	}
+	for _, w := range l.Weights[ring] {
+		if !(w > 0) {
+			return nil
+		}
+	}
+	return l.Weights[ring]
+}
+
+func sum(values []float64) float64 {
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
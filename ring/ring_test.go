@@ -0,0 +1,214 @@
+package ring
+
+import (
+	"math"
+	"testing"
+)
+
+// eps is a nudge well below any segment width, and well above rounding
+// errors.
+const eps = 1e-9
+
+func TestAngle(t *testing.T) {
+	tests := []struct {
+		x, y float64
+		want float64
+	}{
+		{0, -1, 0},
+		{1, -1, math.Pi / 4},
+		{1, 0, math.Pi / 2},
+		{1, 1, 3 * math.Pi / 4},
+		{0, 1, math.Pi},
+		{-1, 1, 5 * math.Pi / 4},
+		{-1, 0, 3 * math.Pi / 2},
+		{-1, -1, 7 * math.Pi / 4},
+		{-eps, -1, 2*math.Pi - eps},
+	}
+	for _, tt := range tests {
+		if got := Angle(tt.x, tt.y); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("Angle(%g, %g) = %g, want %g", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+// TestIndexBoundaries checks that each entry owns the segment centred on
+// it, from its start edge to just before its end edge.
+func TestIndexBoundaries(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 8, 16, 26} {
+		segment := 2 * math.Pi / float64(n)
+		for i := range n {
+			centre := float64(i) * segment
+			start := centre - segment/2
+			end := centre + segment/2
+			for _, angle := range []float64{centre, start + eps, end - eps} {
+				if got := Index(wrap(angle), n); got != i {
+					t.Errorf("Index(%g, %d) = %d, want %d", angle, n, got, i)
+				}
+			}
+			if n > 1 {
+				if got, want := Index(wrap(start-eps), n), (i+n-1)%n; got != want {
+					t.Errorf("Index(%g, %d) just before entry %d = %d, want %d", start-eps, n, i, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestIndexEmpty(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		if got := Index(1, n); got != 0 {
+			t.Errorf("Index(1, %d) = %d, want 0", n, got)
+		}
+	}
+}
+
+func TestRingBands(t *testing.T) {
+	l := Layout{Sizes: []int{10, 10, 10}, Bands: []float64{0.5, 0.9}}
+	tests := []struct {
+		magnitude float64
+		ring      int
+		ok        bool
+	}{
+		{0, 0, false},
+		{Deadzone, 0, false},
+		{Deadzone + eps, 0, true},
+		{0.5 - eps, 0, true},
+		{0.5, 1, true},
+		{0.9 - eps, 1, true},
+		{0.9, 2, true},
+		{1, 2, true},
+		// Diagonals of a square stick gate go past 1
+		{math.Sqrt2, 2, true},
+	}
+	for _, tt := range tests {
+		ring, ok := l.Ring(tt.magnitude)
+		if ring != tt.ring || ok != tt.ok {
+			t.Errorf("Ring(%g) = %d, %v; want %d, %v", tt.magnitude, ring, ok, tt.ring, tt.ok)
+		}
+	}
+}
+
+func TestRingWithoutBands(t *testing.T) {
+	// Rings without a band are never reached
+	l := Layout{Sizes: []int{10, 10}}
+	if ring, ok := l.Ring(1); ring != 0 || !ok {
+		t.Errorf("Ring(1) = %d, %v; want 0, true", ring, ok)
+	}
+	if _, ok := (Layout{}).Ring(1); ok {
+		t.Error("Ring(1) of an empty layout is ok, want nothing selected")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	l := Layout{Sizes: []int{4, 8, 0}, Bands: []float64{0.5, 0.9}}
+	tests := []struct {
+		name        string
+		x, y        float64
+		ring, index int
+		ok          bool
+	}{
+		{"centre", 0, 0, 0, 0, false},
+		{"deadzone", 0, -Deadzone, 0, 0, false},
+		{"inner up", 0, -0.3, 0, 0, true},
+		{"inner right", 0.3, 0, 0, 1, true},
+		{"inner left", -0.3, 0, 0, 3, true},
+		{"outer down-right", 0.5, 0.5, 1, 3, true},
+		{"outer up-left", -0.5, -0.5, 1, 7, true},
+		{"empty ring", 0, 1, 0, 0, false},
+	}
+	for _, tt := range tests {
+		ring, index, ok := l.Select(tt.x, tt.y)
+		if ring != tt.ring || index != tt.index || ok != tt.ok {
+			t.Errorf("%s: Select(%g, %g) = %d, %d, %v; want %d, %d, %v",
+				tt.name, tt.x, tt.y, ring, index, ok, tt.ring, tt.index, tt.ok)
+		}
+	}
+}
+
+// TestPositionRoundTrip checks that the stick pointed at where an entry
+// is drawn selects that entry, with and without weights.
+func TestPositionRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []float64
+	}{
+		{"even", nil},
+		{"equal weights", []float64{1, 1, 1, 1, 1, 1}},
+		{"uneven", []float64{1, 2, 3, 2, 1, 0.5}},
+		{"one wide", []float64{10, 1, 1, 1, 1, 1}},
+		{"first narrow", []float64{0.1, 1, 1, 1, 1, 1}},
+	}
+	for _, tt := range tests {
+		l := Layout{Sizes: []int{6}, Radii: []float64{100}, Weights: [][]float64{tt.weights}}
+		for i := range 6 {
+			x, y := l.Position(0, i)
+			if r := math.Hypot(x, y); math.Abs(r-100) > 1e-9 {
+				t.Errorf("%s: entry %d drawn at radius %g, want 100", tt.name, i, r)
+			}
+			if got := l.Index(0, Angle(x, y)); got != i {
+				t.Errorf("%s: Index at the position of entry %d = %d", tt.name, i, got)
+			}
+		}
+	}
+}
+
+// TestWeightedBoundaries checks that weighted segments have the widths
+// of their weights, with entry 0 centred at 12 o'clock.
+func TestWeightedBoundaries(t *testing.T) {
+	weights := []float64{1, 2, 3, 2}
+	l := Layout{Sizes: []int{4}, Radii: []float64{100}, Weights: [][]float64{weights}}
+	total := sum(weights)
+	start := -weights[0] / 2
+	for i, w := range weights {
+		from := start / total * 2 * math.Pi
+		to := (start + w) / total * 2 * math.Pi
+		for _, angle := range []float64{from + eps, (from + to) / 2, to - eps} {
+			if got := l.Index(0, wrap(angle)); got != i {
+				t.Errorf("Index(%g) = %d, want %d, whose segment is [%g, %g)", angle, got, i, from, to)
+			}
+		}
+		start += w
+	}
+}
+
+// TestUnusableWeights checks that a ring whose weights can't be used is
+// evenly spaced.
+func TestUnusableWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights [][]float64
+	}{
+		{"none", nil},
+		{"unset for the ring", [][]float64{nil}},
+		{"too few", [][]float64{{1, 2, 3}}},
+		{"too many", [][]float64{{1, 2, 3, 4, 5}}},
+		{"zero", [][]float64{{1, 0, 1, 1}}},
+		{"negative", [][]float64{{1, -1, 1, 1}}},
+		{"NaN", [][]float64{{1, math.NaN(), 1, 1}}},
+	}
+	for _, tt := range tests {
+		l := Layout{Sizes: []int{4}, Radii: []float64{100}, Weights: tt.weights}
+		for step := range 64 {
+			angle := float64(step) * 2 * math.Pi / 64
+			if got, want := l.Index(0, angle), Index(angle, 4); got != want {
+				t.Errorf("%s: Index(%g) = %d, want %d as if evenly spaced", tt.name, angle, got, want)
+			}
+		}
+		for i := range 4 {
+			x, y := l.Position(0, i)
+			want := float64(i) * math.Pi / 2
+			if got := Angle(x, y); math.Abs(got-want) > 1e-9 {
+				t.Errorf("%s: entry %d drawn at %g, want %g", tt.name, i, got, want)
+			}
+		}
+	}
+}
+
+// wrap returns angle in [0, 2π).
+func wrap(angle float64) float64 {
+	angle = math.Mod(angle, 2*math.Pi)
+	if angle < 0 {
+		angle += 2 * math.Pi
+	}
+	return angle
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// storageKeyFile holds what is needed to check and derive the encryption
+// key, but not the key itself.
+const storageKeyFile = "storage.json"
+
+// sealedPrefix starts every sealed record. A sealed file is a sequence
+// of records, one per line, each the base64 of a nonce and the AES-GCM
+// sealed bytes; together they make up the file's contents. Appending
+// seals just the appended bytes, so files only ever written to at the end
+// stay that way.
+const sealedPrefix = "enc1:"
+
+// keyIterations is the PBKDF2 cost of deriving a key from a passphrase.
+const keyIterations = 600_000
+
+// storageCheck is sealed into storageKeyFile to tell a wrong key from
+// damaged data.
+const storageCheck = "control"
+
+// storedFiles are the files in the data directory that hold what the
+// user typed.
+var storedFiles = []string{corpusFile, corpusLogFile, corpusHistoryFile, rawTextFile, trainingDataFile}
+
+// keyringKey returns the storage key kept in the system keyring,
+// creating it the first time, where the platform has a keyring.
+var keyringKey func() ([]byte, error)
+
+// storageKeyData is the contents of storageKeyFile.
+type storageKeyData struct {
+	Salt  []byte `json:"salt,omitempty"` // for a passphrase
+	Check string `json:"check"`          // storageCheck, sealed
+}
+
+// errReadOnly is returned by writes to read-only storage.
+var errReadOnly = errors.New("saved data is opened read-only")
+
+// storage reads and writes the files in the data directory, sealing what
+// they hold when encryption is on. Files it creates are only readable by
+// the user.
+type storage struct {
+	dir      string
+	aead     cipher.AEAD // nil for plaintext
+	readOnly bool        // never change the files
+}
+
+// openStorage returns the storage for dir, making sure every stored file
+// is encrypted as configured and, unless readOnly, only readable by the
+// user and without a record cut short at its end.
+func openStorage(dir string, cfg StorageConfig, readOnly bool) (*storage, error) {
+	s, err := newStorage(dir, cfg, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range storedFiles {
+		sealed, err := s.isSealed(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Earlier versions left them readable by everyone
+		if !readOnly {
+			if err := os.Chmod(filepath.Join(dir, name), 0600); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case sealed && s.aead == nil:
+			return nil, fmt.Errorf("%s is encrypted, but storage.encrypt is off", name)
+		case !sealed && s.aead != nil:
+			return nil, fmt.Errorf("%s is not encrypted yet, run \"control encrypt\" first", name)
+		}
+		if sealed && !readOnly {
+			if err := s.dropCutRecord(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// newStorage returns the storage for dir with the configured key,
+// whatever the files in it hold.
+func newStorage(dir string, cfg StorageConfig, readOnly bool) (*storage, error) {
+	s := &storage{dir: dir, readOnly: readOnly}
+	if !cfg.Encrypt {
+		return s, nil
+	}
+
+	path := filepath.Join(dir, storageKeyFile)
+	var stored storageKeyData
+	data, err := os.ReadFile(path)
+	exists := err == nil
+	if exists {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if cfg.PassphraseFile != "" && stored.Salt == nil {
+		stored.Salt = make([]byte, 16)
+		rand.Read(stored.Salt)
+	}
+
+	key, err := storageKey(cfg, stored.Salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if s.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+
+	if exists {
+		check, err := s.open([]byte(stored.Check))
+		if err != nil || string(check) != storageCheck {
+			return nil, errors.New("the storage key doesn't match the one the data was encrypted with")
+		}
+		return s, nil
+	}
+	if readOnly {
+		// Nothing was encrypted with any key yet
+		return s, nil
+	}
+	stored.Check = strings.TrimSuffix(string(s.seal([]byte(storageCheck))), "\n")
+	if data, err = json.Marshal(stored); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// storageKey returns the 256-bit key from the configured passphrase file
+// or else the system keyring.
+func storageKey(cfg StorageConfig, salt []byte) ([]byte, error) {
+	if cfg.PassphraseFile == "" {
+		if keyringKey == nil {
+			return nil, errors.New("no system keyring on this platform, set storage.passphrase_file")
+		}
+		return keyringKey()
+	}
+	path := cfg.PassphraseFile
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, rest)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	if passphrase == "" {
+		return nil, fmt.Errorf("%s: passphrase is empty", path)
+	}
+	return pbkdf2.Key(sha256.New, passphrase, salt, keyIterations, 32)
+}
+
+// isSealed reports whether the file holds sealed records. An empty file
+// counts as whatever the storage writes.
+func (s *storage) isSealed(name string) (bool, error) {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, len(sealedPrefix))
+	n, err := io.ReadFull(f, head)
+	if n == 0 && err == io.EOF {
+		return s.aead != nil, nil
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return string(head[:n]) == sealedPrefix, nil
+}
+
+// seal returns data as a sealed record.
+func (s *storage) seal(data []byte) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	rand.Read(nonce)
+	sealed := s.aead.Seal(nonce, nonce, data, nil)
+	record := make([]byte, 0, len(sealedPrefix)+base64.StdEncoding.EncodedLen(len(sealed))+1)
+	record = append(record, sealedPrefix...)
+	record = base64.StdEncoding.AppendEncode(record, sealed)
+	return append(record, '\n')
+}
+
+// open returns the contents of one sealed record, without its newline.
+func (s *storage) open(record []byte) ([]byte, error) {
+	encoded, ok := bytes.CutPrefix(record, []byte(sealedPrefix))
+	if !ok {
+		return nil, errors.New("not a sealed record")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errors.New("sealed record too short")
+	}
+	nonce, sealed := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	return s.aead.Open(nil, nonce, sealed, nil)
+}
+
+// readFile returns the contents of a file. A record cut short by a crash
+// at the end of a sealed file is dropped from the file, unless the
+// storage is read-only.
+func (s *storage) readFile(name string) ([]byte, error) {
+	path := filepath.Join(s.dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil || s.aead == nil {
+		return data, err
+	}
+
+	var plain bytes.Buffer
+	good := 0 // bytes of whole records
+	for lineNum := 1; good < len(data); lineNum++ {
+		end := bytes.IndexByte(data[good:], '\n')
+		if end < 0 {
+			break // cut short while appending
+		}
+		record, err := s.open(data[good : good+end])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		plain.Write(record)
+		good += end + 1
+	}
+	if good < len(data) && !s.readOnly {
+		log.Printf("%s: dropping a record cut short at the end", path)
+		if err := os.Truncate(path, int64(good)); err != nil {
+			return nil, err
+		}
+	}
+	return plain.Bytes(), nil
+}
+
+// dropCutRecord drops a record cut short by a crash at the end of a
+// sealed file, which the next record appended would otherwise run into,
+// leaving the file unreadable from there on.
+func (s *storage) dropCutRecord(name string) error {
+	path := filepath.Join(s.dir, name)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s: dropping a record cut short at the end", path)
+	return os.Truncate(path, int64(bytes.LastIndexByte(data, '\n')+1))
+}
+
+// writeFile replaces the contents of a file.
+func (s *storage) writeFile(name string, data []byte) error {
+	if s.readOnly {
+		return errReadOnly
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	if s.aead != nil {
+		data = s.seal(data)
+	}
+	return writeFileAtomic(filepath.Join(s.dir, name), data, 0600)
+}
+
+// appendFile adds data to the end of a file, creating it if needed, and
+// with sync set waits until it is on disk.
+func (s *storage) appendFile(name string, data []byte, sync bool) error {
+	if s.readOnly {
+		return errReadOnly
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	if s.aead != nil {
+		data = s.seal(data)
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// stat returns the file's info.
+func (s *storage) stat(name string) (os.FileInfo, error) {
+	return os.Stat(filepath.Join(s.dir, name))
+}
+
+// remove deletes a file if it exists.
+func (s *storage) remove(name string) error {
+	if s.readOnly {
+		return errReadOnly
+	}
+	err := os.Remove(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// files returns the storage of the data directory, plaintext unless the
+// game was given one.
+func (g *Game) files() *storage {
+	if g.store == nil {
+		g.store = &storage{dir: g.dataDir}
+	}
+	return g.store
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestStorageCutRecord checks that a sealed file only ever appended to
+// stays readable after a crash cut its last record short.
+func TestStorageCutRecord(t *testing.T) {
+	dir := t.TempDir()
+	passphrase := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(passphrase, []byte("correct horse\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := StorageConfig{Encrypt: true, PassphraseFile: passphrase}
+
+	s, err := openStorage(dir, cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.appendFile(rawTextFile, []byte("typed "), false); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, rawTextFile), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(sealedPrefix + "cut"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if s, err = openStorage(dir, cfg, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.appendFile(rawTextFile, []byte("after"), false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := s.readFile(rawTextFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "typed after" {
+		t.Errorf("read %q, want %q", data, "typed after")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenizer splits text into sentences of words a rune at a time, so that
+// text typed live splits exactly like the same text read back from disk.
+//
+// Words are runs of letters, digits and underscores, so numbers and code
+// identifiers stay whole. An apostrophe, hyphen or dot between two of
+// those is part of the word ("don't", "well-known", "3.14", "os.Args"),
+// as is a comma between digits ("1,000"). A sentence ends at a newline
+// or at Unicode sentence-ending punctuation that isn't part of a word.
+// Anything else separates words.
+//
+// A rawTextBackspace deletes the rune before it, as if it had never been
+// written. Right after a sentence ended it reopens that sentence, but
+// only the last one: further back, backspaces are ignored.
+type tokenizer struct {
+	// The words of the sentence so far as typed, the last one still
+	// being typed, or "" once it has ended. A joiner at the end of the
+	// last word is only kept if the next rune continues the word.
+	words []string
+
+	// The text of the sentence so far, and of the sentence ended last
+	// with the rune that ended it.
+	text, ended []byte
+}
+
+// write feeds text to the tokenizer and returns the sentences it ended,
+// but for those a backspace in text reopened.
+func (t *tokenizer) write(text string) [][]string {
+	var ended [][]string
+	for _, r := range text {
+		switch sentence, change := t.writeRune(r); {
+		case change > 0:
+			ended = append(ended, sentence)
+		case change < 0 && len(ended) > 0:
+			ended = ended[:len(ended)-1]
+		}
+	}
+	return ended
+}
+
+// writeRune feeds one rune to the tokenizer. It returns the sentence it
+// ended and 1, or the sentence a backspace reopened and -1, or 0 if it
+// did neither.
+func (t *tokenizer) writeRune(r rune) ([]string, int) {
+	if string(r) == rawTextBackspace {
+		return t.deleteRune()
+	}
+	t.text = utf8.AppendRune(t.text, r)
+	sentence, ended := t.split(r)
+	if !ended {
+		return nil, 0
+	}
+	t.ended, t.text = t.text, nil
+	return sentence, 1
+}
+
+// deleteRune deletes the rune last written, reopening the sentence it
+// ended, if it ended one, which it returns with -1.
+func (t *tokenizer) deleteRune() ([]string, int) {
+	text, change := t.text, 0
+	if len(text) == 0 {
+		if len(t.ended) == 0 {
+			return nil, 0
+		}
+		text, t.ended, change = t.ended, nil, -1
+	}
+	_, size := utf8.DecodeLastRune(text)
+	text = text[:len(text)-size]
+
+	// What is left ends no sentence, or it would have ended before
+	var again tokenizer
+	again.write(string(text))
+	t.words, t.text = again.words, text
+	if change < 0 {
+		return t.sentence(), change
+	}
+	return nil, 0
+}
+
+// split adds one rune other than a backspace to the words, and returns
+// the sentence it ended, if it ended one.
+func (t *tokenizer) split(r rune) ([]string, bool) {
+	var word string
+	if n := len(t.words); n > 0 {
+		word = t.words[n-1]
+	}
+	last, size := utf8.DecodeLastRuneInString(word)
+	switch {
+	case wordRune(r):
+		if isJoiner(last) {
+			before, _ := utf8.DecodeLastRuneInString(word[:len(word)-size])
+			if !joins(before, last, r) {
+				sentence, ended := t.breakWord()
+				t.appendRune(r)
+				return sentence, ended
+			}
+		}
+		t.appendRune(r)
+	case isJoiner(r) && wordRune(last):
+		t.appendRune(r)
+	case r == '\n' || unicode.Is(unicode.STerm, r):
+		return t.end(), true
+	default:
+		return t.breakWord()
+	}
+	return nil, false
+}
+
+func (t *tokenizer) appendRune(r rune) {
+	if len(t.words) == 0 {
+		t.words = []string{""}
+	}
+	t.words[len(t.words)-1] += string(r)
+}
+
+// breakWord ends the word being typed, dropping joiners at its end. A dot
+// there ends the sentence, which is returned.
+func (t *tokenizer) breakWord() ([]string, bool) {
+	n := len(t.words)
+	if n == 0 || t.words[n-1] == "" {
+		return nil, false
+	}
+	word := t.words[n-1]
+	t.words[n-1] = strings.TrimRightFunc(word, isJoiner)
+	if strings.Contains(word[len(t.words[n-1]):], ".") {
+		return t.end(), true
+	}
+	t.words = append(t.words, "")
+	return nil, false
+}
+
+// end ends the sentence and returns its words, normalized.
+func (t *tokenizer) end() []string {
+	sentence := t.sentence()
+	t.words = nil
+	return sentence
+}
+
+// sentence returns the words of the sentence so far, normalized.
+func (t *tokenizer) sentence() []string {
+	var sentence []string
+	for _, word := range t.words {
+		if word = normalizeWord(word); word != "" {
+			sentence = append(sentence, word)
+		}
+	}
+	return sentence
+}
+
+// normalizeWord returns a word as it is learned: with straight
+// apostrophes and hyphens and without joiners left at its end.
+func normalizeWord(word string) string {
+	return wordReplacer.Replace(strings.TrimRightFunc(word, isJoiner))
+}
+
+var wordReplacer = strings.NewReplacer("’", "'", "‐", "-")
+
+// wordRune reports whether r makes up words.
+func wordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || r == '_'
+}
+
+// isJoiner reports whether r can join two parts of a word.
+func isJoiner(r rune) bool {
+	switch r {
+	case '\'', '’', '-', '‐', '.', ',':
+		return true
+	}
+	return false
+}
+
+// joins reports whether joiner is part of a word between before and
+// after.
+func joins(before, joiner, after rune) bool {
+	if joiner == ',' {
+		return unicode.IsDigit(before) && unicode.IsDigit(after)
+	}
+	return wordRune(before) && wordRune(after)
+}
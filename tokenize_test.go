@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+var tokenizeTests = []struct {
+	text string
+	want [][]string
+}{
+	{"don't stop", [][]string{{"don't", "stop"}}},
+	{"it’s well‐known", [][]string{{"it's", "well-known"}}},
+	{"a well-known fact", [][]string{{"a", "well-known", "fact"}}},
+	{"pi is 3.14 today", [][]string{{"pi", "is", "3.14", "today"}}},
+	{"call os.Args here", [][]string{{"call", "os.Args", "here"}}},
+	{"it costs 1,000 euros", [][]string{{"it", "costs", "1,000", "euros"}}},
+	{"apples,pears", [][]string{{"apples", "pears"}}},
+	{"the end. Next one", [][]string{{"the", "end"}, {"Next", "one"}}},
+	{"version 2. Next step", [][]string{{"version", "2"}, {"Next", "step"}}},
+	{"a dash- here", [][]string{{"a", "dash", "here"}}},
+	{"what? yes sir! ok", [][]string{{"yes", "sir"}}},
+	{"first line\nsecond line", [][]string{{"first", "line"}, {"second", "line"}}},
+	{"snake_case names", [][]string{{"snake_case", "names"}}},
+	// Backspaces delete as if what they delete had never been typed
+	{"ab \bcd ef", [][]string{{"abcd", "ef"}}},
+	{"ab  \bcd ef", [][]string{{"ab", "cd", "ef"}}},
+	{"ab- \bcd ef", [][]string{{"ab-cd", "ef"}}},
+	{"ab-\b cd", [][]string{{"ab", "cd"}}},
+	{"don't\b\b\bn't stop", [][]string{{"don't", "stop"}}},
+	{"hi\b\b\b\bhello there", [][]string{{"hello", "there"}}},
+	// and reopen the sentence just ended, but no further back
+	{"one two\n\bthree four", [][]string{{"one", "twothree", "four"}}},
+	{"the end. \bx more", [][]string{{"the", "end.x", "more"}}},
+	{"one two\n\n\b\bthree four", [][]string{{"one", "two"}, {"three", "four"}}},
+}
+
+// TestTokenize checks that text splits into the same sentences typed a
+// rune at a time as read back from disk in one go.
+func TestTokenize(t *testing.T) {
+	for _, tt := range tokenizeTests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := parseRawText(tt.text + "\n"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read back: %q, want %q", got, tt.want)
+			}
+
+			g := &Game{output: &recordingOutput{}, dataDir: t.TempDir(), config: defaultConfig()}
+			g.initPrediction()
+			for _, r := range tt.text + "\n" {
+				if string(r) == rawTextBackspace {
+					g.backspace(1)
+				} else {
+					g.trackTyped(string(r))
+				}
+			}
+			_, entries, err := g.corpus.readHistory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A reopened sentence is unlearned
+			var got [][]string
+			for _, e := range entries {
+				if e.weight() > 0 {
+					got = append(got, e.Sentence)
+				} else if n := len(got); n > 0 && reflect.DeepEqual(got[n-1], e.Sentence) {
+					got = got[:n-1]
+				} else {
+					t.Errorf("unlearned %q, which wasn't learned last", e.Sentence)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("typed: %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
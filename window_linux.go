@@ -0,0 +1,53 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	windowClass = x11WindowClass
+	windowSupport = x11WindowSupport
+}
+
+// x11WindowSupport returns why the focused window can't be told: only X11
+// windows can be.
+func x11WindowSupport() error {
+	x11 := os.Getenv("DISPLAY") != ""
+	wayland := os.Getenv("WAYLAND_DISPLAY") != ""
+	switch {
+	case wayland && !x11:
+		return errors.New("as the focused window can't be told on Wayland")
+	case !x11:
+		return errors.New("as there is no display")
+	case wayland:
+		log.Printf("privacy.deny_windows only sees X11 windows, typing in Wayland windows is recorded")
+	}
+	return nil
+}
+
+// x11WindowClass returns the WM_CLASS of the focused X11 window, using
+// xprop, or "" if that fails.
+func x11WindowClass() string {
+	// _NET_ACTIVE_WINDOW(WINDOW): window id # 0x3a00007
+	out, err := exec.Command("xprop", "-root", "_NET_ACTIVE_WINDOW").Output()
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return ""
+	}
+	// WM_CLASS(STRING) = "keepassxc", "KeePassXC"
+	out, err = exec.Command("xprop", "-id", fields[len(fields)-1], "WM_CLASS").Output()
+	if err != nil {
+		return ""
+	}
+	_, class, _ := strings.Cut(strings.TrimSpace(string(out)), " = ")
+	return class
+}
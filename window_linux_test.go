@@ -0,0 +1,27 @@
+//go:build linux
+
+package main
+
+import "testing"
+
+func TestWindowSupport(t *testing.T) {
+	tests := []struct {
+		display, wayland string
+		supported        bool
+	}{
+		{":0", "", true},
+		{":0", "wayland-0", true}, // XWayland windows can be told
+		{"", "wayland-0", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("DISPLAY", tt.display)
+		t.Setenv("WAYLAND_DISPLAY", tt.wayland)
+		if err := x11WindowSupport(); (err == nil) != tt.supported {
+			t.Errorf("DISPLAY=%q WAYLAND_DISPLAY=%q: got %v, want supported %v", tt.display, tt.wayland, err, tt.supported)
+		}
+		if !tt.supported && newWindowWatcher([]string{"password"}) != nil {
+			t.Errorf("DISPLAY=%q WAYLAND_DISPLAY=%q: watching windows that can't be told", tt.display, tt.wayland)
+		}
+	}
+}